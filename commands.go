@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// RunCommand run CLI subcommand by name, detect or export
+func RunCommand(args []string) error {
+	switch args[0] {
+	case "detect":
+		return DetectCSVCommand(args[1:])
+	case "export":
+		return ExportCSVCommand(args[1:])
+	}
+	return fmt.Errorf("Unknown command: %s, expected: detect, export", args[0])
+}
+
+// csvCommandFlags common flags of CSV commands
+func csvCommandFlags(name string) (fs *flag.FlagSet, siteID, file, timeFormat, delimiter *string) {
+	fs = flag.NewFlagSet(name, flag.ContinueOnError)
+	siteID = fs.String("site", "", "DataSet siteId, required")
+	file = fs.String("file", "-", "CSV file path, - for stdin/stdout")
+	timeFormat = fs.String("time-format", DateTimeFormat, "CSV timestamps Go time layout or unix")
+	delimiter = fs.String("delimiter", ",", "CSV columns delimiter, tab for tabs")
+	return
+}
+
+// DetectCSVCommand run DataSet detectors on CSV file values and print results JSON
+func DetectCSVCommand(args []string) error {
+	fs, siteID, file, timeFormat, delimiter := csvCommandFlags("detect")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ds, format, err := csvCommandDataSet(*siteID, *timeFormat, *delimiter)
+
+	if err != nil {
+		return err
+	}
+	var in io.Reader = os.Stdin
+
+	if *file != "-" {
+		f, err := os.Open(*file)
+
+		if err != nil {
+			return fmt.Errorf("Error open CSV file: %s", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	if ds.Metrics, err = ReadMetricsCSV(in, format); err != nil {
+		return err
+	}
+	body, err := json.MarshalIndent(ds.DetectOutliers(), "", "  ")
+
+	if err != nil {
+		return fmt.Errorf("Error encode results: %s", err)
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
+// ExportCSVCommand write DataSet values to CSV file
+func ExportCSVCommand(args []string) error {
+	fs, siteID, file, timeFormat, delimiter := csvCommandFlags("export")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	ds, format, err := csvCommandDataSet(*siteID, *timeFormat, *delimiter)
+
+	if err != nil {
+		return err
+	}
+	if err = ds.LoadData(); err != nil {
+		return err
+	}
+	if *file == "-" {
+		return WriteMetricsCSV(os.Stdout, ds.Metrics, format)
+	}
+	f, err := os.Create(*file)
+
+	if err != nil {
+		return fmt.Errorf("Error create CSV file: %s", err)
+	}
+	defer f.Close()
+	return WriteMetricsCSV(f, ds.Metrics, format)
+}
+
+func csvCommandDataSet(siteID, timeFormat, delimiter string) (*DataSet, CSVFormat, error) {
+	if siteID == "" {
+		return nil, CSVFormat{}, errors.New("Expected -site flag")
+	}
+	format, err := NewCSVFormat(timeFormat, delimiter)
+
+	if err != nil {
+		return nil, format, err
+	}
+	ds, err := GetDataSetBySiteID(siteID)
+	return ds, format, err
+}
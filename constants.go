@@ -9,12 +9,55 @@ const (
 	ReportLogFile = StoreDir + "reports.json"
 )
 
+// ValuesDir DataSets values store directory, variable to be replaced in tests
+var ValuesDir = StoreDir + "values/"
+
+// ValuesCompactInterval minimal interval of DataSet values store compactions, values older than
+// DataSet values retention are dropped from store on values writes
+const ValuesCompactInterval = time.Hour
+
+// MaxIngestBodyBytes maximal size of ingested values request body
+const MaxIngestBodyBytes = 32 << 20
+
+// DataSet values sources types
+const (
+	SourcePush       = "push"
+	SourceSynthetic  = "synthetic"
+	SourcePrometheus = "prometheus"
+	SourceHTTP       = "http"
+	SourceSQL        = "sql"
+)
+
+// SourceHTTPTimeout HTTP data sources request timeout
+const SourceHTTPTimeout = 30 * time.Second
+
+// SourceSQLTimeout SQL data source metrics queries timeout
+const SourceSQLTimeout = 30 * time.Second
+
 // DataSetsCheckInterval dataset outliers checker interval
 const DataSetsCheckInterval = 5 * time.Minute
 
+// DefaultDimensionsTopN default count of attributes of every dimension detected by volume
+const DefaultDimensionsTopN = 10
+
+// DefaultGapsMinRatio default minimal share of usual values count per bucket, buckets below it are gaps
+const DefaultGapsMinRatio = 0.5
+
+// Bayesian online change-point detection runs truncation, less probable runs are dropped
+const (
+	ChangePointMinRunProbability = 1e-6
+	ChangePointMaxRuns           = 200
+)
+
+// DefaultDerivedBucketsPerStep default count of time buckets per TimeStep of derived metrics evaluation
+const DefaultDerivedBucketsPerStep = 24
+
 // DateTimeFormat default date format
 const DateTimeFormat = "2006-01-02 15:04:05"
 
+// TimeFormatUnix CSV time format of Unix seconds timestamps
+const TimeFormatUnix = "unix"
+
 // HTTP server params
 const (
 	ServerPort       = ":8086"
@@ -25,5 +68,62 @@ const (
 
 // Outliers detection methods
 const (
-	ThreeSigmas = "3-sigmas"
+	ThreeSigmas      = "3-sigmas"
+	MAD              = "mad"
+	IQR              = "iqr"
+	Seasonal         = "seasonal-sigmas"
+	EWMA             = "ewma"
+	CUSUM            = "cusum"
+	HoltWinters      = "holt-winters"
+	GESD             = "gesd"
+	IForest          = "isolation-forest"
+	Hampel           = "hampel"
+	Mahalanobis      = "mahalanobis"
+	PeriodOverPeriod = "period-over-period"
+	BOCPD            = "bocpd"
+	Ensemble         = "ensemble"
+	Gaps             = "gaps"
+)
+
+// Resampling aggregation functions
+const (
+	AggregationSum   = "sum"
+	AggregationMean  = "mean"
+	AggregationCount = "count"
+	AggregationMin   = "min"
+	AggregationMax   = "max"
+	AggregationP95   = "p95"
+)
+
+// Resampling empty buckets handling
+const (
+	EmptySkip        = "skip"
+	EmptyZero        = "zero"
+	EmptyPrevious    = "previous"
+	EmptyInterpolate = "interpolate"
+)
+
+// LevelNone outlier level of regular values, outliers levels are 1-based indexes of DataSet severity levels
+const LevelNone = 0
+
+// LevelGapName severity level name of data gaps
+const LevelGapName = "gap"
+
+// Default severity levels names of OutliersMultipler and StrongOutliersMultipler
+const (
+	LevelWarningName = "warning"
+	LevelAlarmName   = "alarm"
+)
+
+// Result keys of default severity levels, custom levels records are keyed by levels names
+const (
+	ResultWarningsKey = "Warnings"
+	ResultAlarmsKey   = "Alarms"
+)
+
+// Outliers directions
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+	DirectionBoth = "both"
 )
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CSVFormat metrics values CSV format, columns are timestamp, metric, attribute, value
+type CSVFormat struct {
+	// TimeFormat Go time layout of timestamps or unix for Unix seconds, DateTimeFormat by default
+	TimeFormat string
+	// Delimiter columns delimiter, comma by default
+	Delimiter rune
+}
+
+// CSVHeader metrics values CSV columns
+var CSVHeader = []string{"timestamp", "metric", "attribute", "value"}
+
+// NewCSVFormat make CSVFormat by time format and delimiter strings, empty values are defaults
+func NewCSVFormat(timeFormat, delimiter string) (CSVFormat, error) {
+	format := CSVFormat{TimeFormat: timeFormat, Delimiter: ','}
+
+	if format.TimeFormat == "" {
+		format.TimeFormat = DateTimeFormat
+	}
+	switch delimiter {
+	case "":
+	case "tab", `\t`:
+		format.Delimiter = '\t'
+	default:
+		if utf8.RuneCountInString(delimiter) != 1 {
+			return format, fmt.Errorf("Invalid CSV delimiter %q, expected single character", delimiter)
+		}
+		format.Delimiter, _ = utf8.DecodeRuneInString(delimiter)
+	}
+	return format, nil
+}
+
+// ParseTime parse CSV timestamp by format
+func (f CSVFormat) ParseTime(s string) (time.Time, error) {
+	if f.TimeFormat == TimeFormatUnix {
+		sec, err := strconv.ParseInt(s, 10, 64)
+		return time.Unix(sec, 0).UTC(), err
+	}
+	t, err := time.Parse(f.TimeFormat, s)
+	return t.UTC(), err
+}
+
+// FormatTime format CSV timestamp by format
+func (f CSVFormat) FormatTime(t time.Time) string {
+	if f.TimeFormat == TimeFormatUnix {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	return t.UTC().Format(f.TimeFormat)
+}
+
+// ReadMetricsCSV read metrics values from CSV, header row is optional, values are grouped by metric and attribute
+// and sorted by date
+func ReadMetricsCSV(r io.Reader, format CSVFormat) (metrics []MetricValues, err error) {
+	reader := csv.NewReader(r)
+	reader.Comma = format.Delimiter
+	reader.FieldsPerRecord = len(CSVHeader)
+	reader.TrimLeadingSpace = !unicode.IsSpace(format.Delimiter)
+	index := make(map[string]int)
+
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Error read CSV: %s", err)
+		}
+		if line == 1 && strings.EqualFold(row[0], CSVHeader[0]) {
+			continue
+		}
+		date, err := format.ParseTime(row[0])
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CSV timestamp at line %d: %s", line, row[0])
+		}
+		value, err := strconv.ParseFloat(row[3], 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CSV value at line %d: %s", line, row[3])
+		}
+		if row[1] == "" {
+			return nil, fmt.Errorf("Empty CSV metric at line %d", line)
+		}
+		metrics = AddMetricValue(metrics, index, row[1], row[2], DataSetValue{date, value})
+	}
+	if len(metrics) == 0 {
+		return nil, errors.New("Empty CSV")
+	}
+	SortMetricsValues(metrics)
+	return metrics, nil
+}
+
+// WriteMetricsCSV write metrics values to CSV with header row
+func WriteMetricsCSV(w io.Writer, metrics []MetricValues, format CSVFormat) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = format.Delimiter
+
+	if err := writer.Write(CSVHeader); err != nil {
+		return fmt.Errorf("Error write CSV: %s", err)
+	}
+	for _, mv := range metrics {
+		for _, v := range mv.Values {
+			row := []string{format.FormatTime(v.Date), mv.Metric, mv.Attribute, strconv.FormatFloat(v.Value, 'g', -1, 64)}
+
+			if err := writer.Write(row); err != nil {
+				return fmt.Errorf("Error write CSV: %s", err)
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsCSVRoundTrip(t *testing.T) {
+	orders := testSeries("Orders", 3, time.Hour, func(i int) float64 { return float64(i) + 0.5 })
+	orders.Attribute = "country=DE"
+	metrics := []MetricValues{
+		testSeries("Revenue", 4, time.Hour, func(i int) float64 { return 100 * float64(i) }),
+		orders,
+	}
+	tests := []struct {
+		timeFormat string
+		delimiter  string
+	}{
+		{"", ""},
+		{TimeFormatUnix, ";"},
+		{time.RFC3339, "tab"},
+	}
+	for _, tt := range tests {
+		format, err := NewCSVFormat(tt.timeFormat, tt.delimiter)
+
+		if err != nil {
+			t.Fatalf("Error make CSV format: %s", err)
+		}
+		var buf bytes.Buffer
+
+		if err = WriteMetricsCSV(&buf, metrics, format); err != nil {
+			t.Fatalf("Error write CSV: %s", err)
+		}
+		read, err := ReadMetricsCSV(&buf, format)
+
+		if err != nil {
+			t.Fatalf("%q %q: error read CSV: %s", tt.timeFormat, tt.delimiter, err)
+		}
+		if !reflect.DeepEqual(read, metrics) {
+			t.Errorf("%q %q: expected %v, got %v", tt.timeFormat, tt.delimiter, metrics, read)
+		}
+	}
+}
+
+func TestReadMetricsCSV(t *testing.T) {
+	format, _ := NewCSVFormat("", "")
+	rows := "2021-01-04 02:00:00,Revenue,,3\n" +
+		"2021-01-04 00:00:00,Orders,,1\n" +
+		"2021-01-04 00:00:00,Revenue,,1\n" +
+		"2021-01-04 01:00:00,Revenue,,2\n"
+	metrics, err := ReadMetricsCSV(strings.NewReader(rows), format)
+
+	if err != nil {
+		t.Fatalf("Error read CSV: %s", err)
+	}
+	if len(metrics) != 2 || metrics[0].Metric != "Revenue" || metrics[1].Metric != "Orders" {
+		t.Fatalf("Expected Revenue and Orders metrics values, got %v", metrics)
+	}
+	for i, v := range metrics[0].Values {
+		if v.Value != float64(i+1) || !v.Date.Equal(testStartDate.Add(time.Duration(i)*time.Hour)) {
+			t.Errorf("Expected values sorted by date, got %v", metrics[0].Values)
+			break
+		}
+	}
+	for _, rows := range []string{"", "2021-01-04,Revenue,,1\n", "2021-01-04 00:00:00,,,1\n", "2021-01-04 00:00:00,Revenue,1\n"} {
+		if _, err = ReadMetricsCSV(strings.NewReader(rows), format); err == nil {
+			t.Errorf("Expected error of CSV %q", rows)
+		}
+	}
+}
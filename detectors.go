@@ -2,38 +2,51 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"math/rand"
 	"time"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat"
+	"gonum.org/v1/gonum/stat/distuv"
 )
 
+// ThreeSigmasDetector 3-sigmas rule Detector
+type ThreeSigmasDetector struct{}
+
+// Name return method name
+func (ThreeSigmasDetector) Name() string {
+	return ThreeSigmas
+}
+
+// Params return method params schema
+func (ThreeSigmasDetector) Params() []DetectorParam {
+	return nil
+}
+
+// Detect detect outliers by 3-sigmas rule
+func (ThreeSigmasDetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	return ThreeSigmasOutlierDetector(ds, mv)
+}
+
 // ThreeSigmasOutlierDetector outlier detection by 3-sigmas rule
 func ThreeSigmasOutlierDetector(ds DataSet, mv MetricValues) (*OutlierDetectOutput, error) {
 	checkStartTime := time.Now().UTC()
 
-	if len(mv.Values) == 0 {
-		return nil, errors.New("Empty values")
-	}
-	timeDuration, timeStep, err := ds.GetTimeAgoAndTimeStepDurations()
+	window, err := ds.GetDetectionWindow(mv)
 
 	if err != nil {
 		return nil, err
 	}
-	endDate := mv.Values[mv.Values.Len()-1].Date.Truncate(timeStep)
-	startDate := endDate.Add(-timeDuration).Round(timeStep)
-
-	minDetectionValue := float64(timeStep / timeDuration * time.Duration(ds.MinVisitorsPerTimeStep))
-	values := mv.Values.FilterByDatesAndMinValue(startDate, endDate, minDetectionValue)
-
-	if values.Len() == 0 {
-		return nil, errors.New("No available values for detecting")
-	}
-	output := ds.MakeOutlierOutput(startDate, endDate)
+	output := ds.MakeOutlierOutput(ThreeSigmas, window.StartDate, window.EndDate)
 
 	defer func() {
 		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
 		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
 	}()
 
-	parts := values.BreakIntoPieces(timeStep)
+	parts := window.Values.BreakIntoPieces(window.TimeStep)
 	means := make([]float64, len(parts))
 	stDevs := make([]float64, len(parts))
 
@@ -43,36 +56,1146 @@ func ThreeSigmasOutlierDetector(ds DataSet, mv MetricValues) (*OutlierDetectOutp
 	commonMean, _ := MeanStDev(means...)
 	commonStDev, _ := MeanStDev(stDevs...)
 
-	warnUpperLimit := commonMean + commonStDev*ds.OutliersDetection.OutliersMultipler
-	alarmUpperLimit := commonMean + commonStDev*ds.OutliersDetection.StrongOutliersMultipler
+	if commonStDev == 0 {
+		return output, nil
+	}
+	for _, direction := range ds.GetDirections(mv.Metric) {
+		sign := DirectionSign(direction)
+		levels := ds.OutliersDetection.GetLevels()
+		limits := make([]float64, len(levels))
 
-	for indx, part := range parts {
-		if means[indx] < commonMean {
-			continue
+		for i := range levels {
+			limits[i] = commonMean + sign*commonStDev*levels[i].Multipler
 		}
-		for start := 1; start < part.Len(); start++ {
-			if part[start].Value <= warnUpperLimit {
+
+		for indx, part := range parts {
+			if sign*means[indx] < sign*commonMean {
 				continue
 			}
-			stop := start
+			partLimit := means[indx] + sign*stDevs[indx]
 
-			for part[stop].Value > means[indx]+stDevs[indx] && stop < part.Len() {
-				stop++
+			for start := 1; start < part.Len(); start++ {
+				if sign*part[start].Value <= sign*limits[0] {
+					continue
+				}
+				stop := start
+
+				for stop < part.Len()-1 && sign*part[stop].Value > sign*partLimit {
+					stop++
+				}
+				run := part[start:stop]
+
+				if run.Len() == 0 {
+					run = part[start : start+1]
+				}
+				mean := Mean(run.GetValues()...)
+				level := 1
+
+				for level < len(limits) && sign*mean > sign*limits[level] {
+					level++
+				}
+				threshold := limits[level-1]
+
+				output.AddRecord(level, OutlierDetectResultRecord{
+					OutlierPeriodStart: part[start-1].Date.Format(DateTimeFormat),
+					OutlierPeriodEnd:   part[stop].Date.Format(DateTimeFormat),
+					Metric:             mv.Metric,
+					Attribute:          mv.Attribute,
+					Direction:          direction,
+					Score:              sign * (mean - commonMean) / commonStDev,
+					Peak:               run.Peak(sign),
+					Expected:           commonMean,
+					Threshold:          threshold,
+				})
+				start = stop
 			}
-			result := OutlierDetectResultRecord{
-				OutlierPeriodStart: part[start-1].Date.Format(DateTimeFormat),
-				OutlierPeriodEnd:   part[stop].Date.Format(DateTimeFormat),
+		}
+	}
+	return output, nil
+}
+
+// MADDetector median absolute deviation (modified z-score) Detector
+type MADDetector struct{}
+
+// Name return method name
+func (MADDetector) Name() string {
+	return MAD
+}
+
+// Params return method params schema
+func (MADDetector) Params() []DetectorParam {
+	return nil
+}
+
+// Detect detect outliers by modified z-score
+func (MADDetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	return MADOutlierDetector(ds, mv)
+}
+
+// MADOutlierDetector outlier detection by modified z-score 0.6745*(x-median)/MAD of every TimeStep part
+func MADOutlierDetector(ds DataSet, mv MetricValues) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	window, err := ds.GetDetectionWindow(mv)
+
+	if err != nil {
+		return nil, err
+	}
+	output := ds.MakeOutlierOutput(MAD, window.StartDate, window.EndDate)
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	for _, part := range window.Values.BreakIntoPieces(window.TimeStep) {
+		median, mad := part.GetMedianMAD()
+
+		if mad == 0 {
+			continue
+		}
+		points := make([]OutlierPoint, part.Len())
+
+		for i := range part {
+			points[i] = ds.MarkOutlier(mv.Metric, part[i].Value, median, mad/0.6745)
+		}
+		output.AddOutliers(mv, part, points)
+	}
+	return output, nil
+}
+
+// IQRDetector Tukey interquartile range fences Detector
+type IQRDetector struct{}
+
+// Name return method name
+func (IQRDetector) Name() string {
+	return IQR
+}
+
+// Params return method params schema
+func (IQRDetector) Params() []DetectorParam {
+	return nil
+}
+
+// Detect detect outliers by Tukey fences
+func (IQRDetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	return IQROutlierDetector(ds, mv)
+}
+
+// IQROutlierDetector outlier detection by Tukey fences Q1-k*IQR and Q3+k*IQR over TimeAgo window,
+// OutliersMultipler is inner (warning) fence k and StrongOutliersMultipler is outer (alarm) fence k
+func IQROutlierDetector(ds DataSet, mv MetricValues) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	window, err := ds.GetDetectionWindow(mv)
+
+	if err != nil {
+		return nil, err
+	}
+	output := ds.MakeOutlierOutput(IQR, window.StartDate, window.EndDate)
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	vals := window.Values.GetValues()
+	q1, q3 := Quantile(0.25, vals...), Quantile(0.75, vals...)
+	iqr := q3 - q1
+
+	if iqr == 0 {
+		return output, nil
+	}
+	points := make([]OutlierPoint, len(vals))
+
+	for i, val := range vals {
+		if val > q3 {
+			points[i] = ds.MarkOutlier(mv.Metric, val, q3, iqr)
+		} else if val < q1 {
+			points[i] = ds.MarkOutlier(mv.Metric, val, q1, iqr)
+		}
+	}
+	output.AddOutliers(mv, window.Values, points)
+	return output, nil
+}
+
+// SeasonalSigmasDetector hour-of-day (and weekday) baseline sigmas Detector
+type SeasonalSigmasDetector struct{}
+
+// Name return method name
+func (SeasonalSigmasDetector) Name() string {
+	return Seasonal
+}
+
+// Params return method params schema
+func (SeasonalSigmasDetector) Params() []DetectorParam {
+	return []DetectorParam{
+		{Name: "weekday", Description: "Build baseline per weekday and hour-of-day (1) or per hour-of-day only (0)", Default: 0, Min: 0, Max: 1},
+		{Name: "minSlotValues", Description: "Minimal values count in baseline slot to evaluate its values", Default: 3, Min: 2, Max: 1000},
+	}
+}
+
+// Detect detect outliers against hour-of-day slots baselines
+func (SeasonalSigmasDetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	return SeasonalSigmasOutlierDetector(ds, mv, params["weekday"] == 1, int(params["minSlotValues"]))
+}
+
+// SeasonalSigmasOutlierDetector outlier detection by sigmas rule, where every value is evaluated
+// against mean and standard deviation of its hour-of-day (and weekday) slot over TimeAgo window
+func SeasonalSigmasOutlierDetector(ds DataSet, mv MetricValues, weekday bool, minSlotValues int) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	window, err := ds.GetDetectionWindow(mv)
+
+	if err != nil {
+		return nil, err
+	}
+	output := ds.MakeOutlierOutput(Seasonal, window.StartDate, window.EndDate)
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	slots := window.Values.GroupBySeasonalSlot(weekday)
+	means := make(map[int]float64, len(slots))
+	stDevs := make(map[int]float64, len(slots))
+
+	for slot, vals := range slots {
+		if len(vals) >= minSlotValues {
+			means[slot], stDevs[slot] = MeanStDev(vals...)
+		}
+	}
+	points := make([]OutlierPoint, window.Values.Len())
+
+	for i, v := range window.Values {
+		slot := SeasonalSlot(v.Date, weekday)
+
+		if stDevs[slot] == 0 {
+			continue
+		}
+		points[i] = ds.MarkOutlier(mv.Metric, v.Value, means[slot], stDevs[slot])
+	}
+	output.AddOutliers(mv, window.Values, points)
+	return output, nil
+}
+
+// EWMADetector exponentially weighted moving average control chart Detector
+type EWMADetector struct{}
+
+// Name return method name
+func (EWMADetector) Name() string {
+	return EWMA
+}
+
+// Params return method params schema
+func (EWMADetector) Params() []DetectorParam {
+	return []DetectorParam{
+		{Name: "lambda", Description: "Smoothing factor, lower values are more sensitive to small sustained shifts", Default: 0.2, Min: 0.01, Max: 1},
+	}
+}
+
+// Detect detect outliers by EWMA control chart
+func (EWMADetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	return EWMAOutlierDetector(ds, mv, params["lambda"])
+}
+
+// EWMAOutlierDetector outlier detection by EWMA control chart z = lambda*x + (1-lambda)*z,
+// OutliersMultipler and StrongOutliersMultipler are warning and alarm L-sigma control limits
+func EWMAOutlierDetector(ds DataSet, mv MetricValues, lambda float64) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	window, err := ds.GetDetectionWindow(mv)
+
+	if err != nil {
+		return nil, err
+	}
+	output := ds.MakeOutlierOutput(EWMA, window.StartDate, window.EndDate)
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	mean, stDev := window.Values.GetMeanStDev()
+
+	if stDev == 0 {
+		return output, nil
+	}
+	points := make([]OutlierPoint, window.Values.Len())
+	ewma, decay := mean, 1.0
+
+	for i, v := range window.Values {
+		ewma = lambda*v.Value + (1-lambda)*ewma
+		decay *= (1 - lambda) * (1 - lambda)
+		ewmaStDev := stDev * math.Sqrt(lambda/(2-lambda)*(1-decay))
+		points[i] = ds.MarkOutlier(mv.Metric, ewma, mean, ewmaStDev)
+		points[i].Value = v.Value
+	}
+	output.AddOutliers(mv, window.Values, points)
+	return output, nil
+}
+
+// CUSUMDetector two-sided cumulative sum level shift Detector
+type CUSUMDetector struct{}
+
+// Name return method name
+func (CUSUMDetector) Name() string {
+	return CUSUM
+}
+
+// Params return method params schema
+func (CUSUMDetector) Params() []DetectorParam {
+	return []DetectorParam{
+		{Name: "k", Description: "Allowed slack in standard deviations before shift accumulation", Default: 0.5, Min: 0, Max: 10},
+		{Name: "h", Description: "Decision interval in standard deviations, multiplied by outliers multipliers", Default: 2, Min: 0.1, Max: 100},
+	}
+}
+
+// Detect detect level shifts by CUSUM statistics
+func (CUSUMDetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	return CUSUMOutlierDetector(ds, mv, params["k"], params["h"])
+}
+
+// CUSUMOutlierDetector level shift detection by two-sided CUSUM statistics of values standardized by median and MAD,
+// outlier period starts at last statistic reset before crossing h*OutliersMultipler (warning) or
+// h*StrongOutliersMultipler (alarm) and ends when statistic resets
+func CUSUMOutlierDetector(ds DataSet, mv MetricValues, k, h float64) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	window, err := ds.GetDetectionWindow(mv)
+
+	if err != nil {
+		return nil, err
+	}
+	output := ds.MakeOutlierOutput(CUSUM, window.StartDate, window.EndDate)
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	median, mad := window.Values.GetMedianMAD()
+	stDev := 1.4826 * mad
+
+	if stDev == 0 {
+		return output, nil
+	}
+	values := window.Values
+
+	for _, direction := range ds.GetDirections(mv.Metric) {
+		sign := DirectionSign(direction)
+		var sum, maxSum float64
+		reset, level := 0, LevelNone
+
+		addRecord := func(stop int) {
+			output.AddRecord(level, OutlierDetectResultRecord{
+				OutlierPeriodStart: values[reset].Date.Format(DateTimeFormat),
+				OutlierPeriodEnd:   values[stop].Date.Format(DateTimeFormat),
 				Metric:             mv.Metric,
 				Attribute:          mv.Attribute,
+				Direction:          direction,
+				Score:              maxSum,
+				Peak:               values[reset : stop+1].Peak(sign),
+				Expected:           median,
+				Threshold:          h * ds.OutliersDetection.Multipler(level),
+			})
+		}
+
+		for i, v := range values {
+			sum = math.Max(0, sum+sign*(v.Value-median)/stDev-k)
+
+			if sum > 0 {
+				maxSum = math.Max(maxSum, sum)
+
+				if lvl := ds.OutliersDetection.GetLevel(sum / h); lvl > level {
+					level = lvl
+				}
+				continue
+			}
+			if level != LevelNone {
+				addRecord(i)
+			}
+			reset, level, maxSum = i, LevelNone, 0
+		}
+		if level != LevelNone {
+			addRecord(values.Len() - 1)
+		}
+	}
+	return output, nil
+}
+
+// HoltWintersDetector triple exponential smoothing forecast Detector
+type HoltWintersDetector struct{}
+
+// Name return method name
+func (HoltWintersDetector) Name() string {
+	return HoltWinters
+}
+
+// Params return method params schema
+func (HoltWintersDetector) Params() []DetectorParam {
+	return []DetectorParam{
+		{Name: "alpha", Description: "Level smoothing factor", Default: 0.3, Min: 0, Max: 1},
+		{Name: "beta", Description: "Trend smoothing factor", Default: 0.05, Min: 0, Max: 1},
+		{Name: "gamma", Description: "Season smoothing factor", Default: 0.3, Min: 0, Max: 1},
+		{Name: "seasonBuckets", Description: "Buckets count in season, season length is TimeStep", Default: 24, Min: 2, Max: 1440},
+	}
+}
+
+// Detect detect outliers outside Holt-Winters forecast prediction interval
+func (HoltWintersDetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	return HoltWintersOutlierDetector(ds, mv, params)
+}
+
+// Forecast return Holt-Winters expected values of TimeAgo window buckets
+func (HoltWintersDetector) Forecast(ds DataSet, mv MetricValues, params DetectorParams) (DataSetValues, error) {
+	_, _, expected, err := FitHoltWinters(ds, mv, params)
+	return expected, err
+}
+
+// FitHoltWinters fit Holt-Winters model on TimeAgo window values bucketed by TimeStep/seasonBuckets without
+// window end date bucket, return actual and expected values of buckets having a forecast
+func FitHoltWinters(ds DataSet, mv MetricValues, params DetectorParams) (window *DetectionWindow, actual, expected DataSetValues, err error) {
+	window, err = ds.GetDetectionWindow(mv)
+
+	if err != nil {
+		return
+	}
+	season := int(params["seasonBuckets"])
+	bucket := window.TimeStep / time.Duration(season)
+
+	if bucket <= 0 {
+		return nil, nil, nil, errors.New("Too many season buckets for TimeStep")
+	}
+	count := int(window.EndDate.Sub(window.StartDate) / bucket)
+	series := window.Values.BucketMeans(window.StartDate, bucket, count)
+	forecast := HoltWintersForecast(series, season, params["alpha"], params["beta"], params["gamma"])
+
+	for i := range series {
+		if !math.IsNaN(forecast[i]) {
+			date := window.StartDate.Add(time.Duration(i) * bucket)
+			actual = append(actual, DataSetValue{date, series[i]})
+			expected = append(expected, DataSetValue{date, forecast[i]})
+		}
+	}
+	if actual.Len() == 0 {
+		return nil, nil, nil, errors.New("Not enough values for Holt-Winters forecast, expected at least 2 seasons")
+	}
+	return
+}
+
+// HoltWintersOutlierDetector outlier detection by Holt-Winters forecast residuals, prediction interval is
+// OutliersMultipler (warning) and StrongOutliersMultipler (alarm) robust standard deviations of residuals
+func HoltWintersOutlierDetector(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	window, actual, expected, err := FitHoltWinters(ds, mv, params)
+
+	if err != nil {
+		return nil, err
+	}
+	output := ds.MakeOutlierOutput(HoltWinters, window.StartDate, window.EndDate)
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	residuals := make([]float64, actual.Len())
+
+	for i := range actual {
+		residuals[i] = actual[i].Value - expected[i].Value
+	}
+	_, mad := MedianMAD(residuals...)
+	stDev := 1.4826 * mad
+
+	if stDev == 0 {
+		return output, nil
+	}
+	points := make([]OutlierPoint, len(residuals))
+
+	for i := range residuals {
+		points[i] = ds.MarkOutlier(mv.Metric, actual[i].Value, expected[i].Value, stDev)
+	}
+	output.AddOutliers(mv, actual, points)
+	return output, nil
+}
+
+// GESDDetector generalized extreme Studentized deviate test Detector
+type GESDDetector struct{}
+
+// Name return method name
+func (GESDDetector) Name() string {
+	return GESD
+}
+
+// Params return method params schema
+func (GESDDetector) Params() []DetectorParam {
+	return []DetectorParam{
+		{Name: "maxAnomalies", Description: "Maximal fraction of window values tested as outliers", Default: 0.05, Min: 0, Max: 0.5},
+		{Name: "alpha", Description: "Significance level of warnings", Default: 0.05, Min: 1e-12, Max: 1},
+		{Name: "strongAlpha", Description: "Significance level of alarms", Default: 0.001, Min: 1e-12, Max: 1},
+		{Name: "seasonal", Description: "Test residuals after removing hour-of-day medians (1) or raw values (0)", Default: 0, Min: 0, Max: 1},
+	}
+}
+
+// CheckParams check alarms significance level is not weaker than warnings one
+func (d GESDDetector) CheckParams(params DetectorParams) error {
+	return CheckParamsOrder(d, params, "strongAlpha", "alpha")
+}
+
+// Detect detect outliers by generalized ESD test
+func (GESDDetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	return GESDOutlierDetector(ds, mv, params)
+}
+
+// GESDOutlierDetector outlier detection by Rosner's generalized ESD test over TimeAgo window,
+// with seasonal param the test is applied to residuals after removing hour-of-day medians (S-H-ESD)
+func GESDOutlierDetector(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	window, err := ds.GetDetectionWindow(mv)
+
+	if err != nil {
+		return nil, err
+	}
+	output := ds.MakeOutlierOutput(GESD, window.StartDate, window.EndDate)
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	residuals := window.Values.GetValues()
+
+	if params["seasonal"] == 1 {
+		medians := make(map[int]float64)
+
+		for slot, vals := range window.Values.GroupBySeasonalSlot(false) {
+			medians[slot] = Median(vals...)
+		}
+		for i, v := range window.Values {
+			residuals[i] -= medians[SeasonalSlot(v.Date, false)]
+		}
+	}
+	maxAnomalies := int(params["maxAnomalies"] * float64(len(residuals)))
+	alphas := ds.OutliersDetection.Thresholds(math.Log(params["alpha"]), math.Log(params["strongAlpha"]))
+
+	for i := range alphas {
+		alphas[i] = math.Exp(alphas[i])
+	}
+	candidates, counts := GeneralizedESD(residuals, maxAnomalies, alphas...)
+	center := Median(residuals...)
+	points := make([]OutlierPoint, len(residuals))
+
+	for i, c := range candidates[:counts[0]] {
+		level, direction := 1, DirectionUp
+
+		for level < len(counts) && i < counts[level] {
+			level++
+		}
+		threshold := c.Critical[level-1]
+
+		if residuals[c.Index] < center {
+			direction = DirectionDown
+		}
+		if ds.HasDirection(mv.Metric, direction) {
+			value := window.Values[c.Index].Value
+			points[c.Index] = OutlierPoint{
+				Level:     level,
+				Direction: direction,
+				Score:     c.Statistic,
+				Value:     value,
+				Expected:  value - residuals[c.Index] + center,
+				Threshold: threshold,
 			}
+		}
+	}
+	output.AddOutliers(mv, window.Values, points)
+	return output, nil
+}
+
+// IsolationForestDetector multivariate isolation forest Detector
+type IsolationForestDetector struct{}
+
+// Name return method name
+func (IsolationForestDetector) Name() string {
+	return IForest
+}
+
+// Params return method params schema
+func (IsolationForestDetector) Params() []DetectorParam {
+	return []DetectorParam{
+		{Name: "trees", Description: "Isolation trees count", Default: 100, Min: 1, Max: 1000},
+		{Name: "sampleSize", Description: "Buckets sample size of every tree", Default: 256, Min: 2, Max: 10000},
+		{Name: "bucketsPerStep", Description: "Common time buckets count per TimeStep", Default: 24, Min: 1, Max: 1440},
+		{Name: "warningScore", Description: "Anomaly score of warnings", Default: 0.6, Min: 0.5, Max: 1},
+		{Name: "alarmScore", Description: "Anomaly score of alarms", Default: 0.7, Min: 0.5, Max: 1},
+		{Name: "seed", Description: "Random generator seed", Default: 1, Min: 0, Max: math.MaxInt32},
+	}
+}
+
+// CheckParams check alarms anomaly score is not below warnings one
+func (d IsolationForestDetector) CheckParams(params DetectorParams) error {
+	return CheckParamsOrder(d, params, "warningScore", "alarmScore")
+}
+
+// Detect detect outliers of single metric by isolation forest
+func (d IsolationForestDetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	ds.Metrics = []MetricValues{mv}
+	return d.DetectMetrics(ds, params)
+}
+
+// DetectMetrics detect outliers of all DataSet metrics together by isolation forest
+func (IsolationForestDetector) DetectMetrics(ds DataSet, params DetectorParams) (*OutlierDetectOutput, error) {
+	return IsolationForestOutlierDetector(ds, params)
+}
+
+// IsolationForestOutlierDetector outlier detection by isolation forest trained on DataSet metrics aligned onto
+// common time buckets over TimeAgo window, buckets with anomaly score above warningScore and alarmScore are outliers
+func IsolationForestOutlierDetector(ds DataSet, params DetectorParams) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	aligned, err := ds.AlignMetrics(int(params["bucketsPerStep"]))
+
+	if err != nil {
+		return nil, err
+	}
+	output := ds.MakeOutlierOutput(IForest, aligned.Window.StartDate, aligned.Window.EndDate)
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	rnd := rand.New(rand.NewSource(int64(params["seed"])))
+	forest := NewIsolationForest(aligned.Rows, int(params["trees"]), int(params["sampleSize"]), rnd)
+	thresholds := ds.OutliersDetection.Thresholds(params["warningScore"], params["alarmScore"])
+	scores := make([]float64, len(aligned.Rows))
+	points := make([]OutlierPoint, len(aligned.Rows))
+
+	for i, row := range aligned.Rows {
+		scores[i] = forest.Score(row)
+		level := ds.OutliersDetection.GetThresholdLevel(scores[i], thresholds)
+
+		if level == LevelNone {
+			continue
+		}
+		threshold := thresholds[level-1]
+		points[i] = aligned.DeviatingPoint(i, ds.OutliersDetection.Multipler(1))
+		points[i].Level, points[i].Score, points[i].Threshold = level, scores[i], threshold
+	}
+	output.AddOutliers(MetricValues{Metric: aligned.Label()}, aligned.Values(scores), points)
+	return output, nil
+}
+
+// HampelDetector rolling median Hampel filter Detector
+type HampelDetector struct{}
+
+// Name return method name
+func (HampelDetector) Name() string {
+	return Hampel
+}
+
+// Params return method params schema
+func (HampelDetector) Params() []DetectorParam {
+	return []DetectorParam{
+		{Name: "width", Description: "Sliding window width in TimeStep units", Default: 0.25, Min: 0.01, Max: 30},
+	}
+}
+
+// Detect detect outliers by Hampel filter
+func (HampelDetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	return HampelOutlierDetector(ds, mv, params["width"])
+}
+
+// HampelOutlierDetector outlier detection by Hampel filter, every value is compared with median and MAD of
+// sliding window centered on it, OutliersMultipler and StrongOutliersMultipler are warning and alarm
+// cut-offs in robust standard deviations 1.4826*MAD
+func HampelOutlierDetector(ds DataSet, mv MetricValues, width float64) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	window, err := ds.GetDetectionWindow(mv)
+
+	if err != nil {
+		return nil, err
+	}
+	output := ds.MakeOutlierOutput(Hampel, window.StartDate, window.EndDate)
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	values := window.Values
+	halfWidth := time.Duration(width * float64(window.TimeStep) / 2)
+	points := make([]OutlierPoint, values.Len())
+	low, high := 0, 0
+
+	for i, v := range values {
+		for values[low].Date.Before(v.Date.Add(-halfWidth)) {
+			low++
+		}
+		for high < values.Len() && !values[high].Date.After(v.Date.Add(halfWidth)) {
+			high++
+		}
+		median, mad := values[low:high].GetMedianMAD()
+
+		if mad == 0 {
+			continue
+		}
+		points[i] = ds.MarkOutlier(mv.Metric, v.Value, median, 1.4826*mad)
+	}
+	output.AddOutliers(mv, values, points)
+	return output, nil
+}
+
+// MahalanobisDetector multivariate Mahalanobis distance Detector
+type MahalanobisDetector struct{}
+
+// Name return method name
+func (MahalanobisDetector) Name() string {
+	return Mahalanobis
+}
+
+// Params return method params schema
+func (MahalanobisDetector) Params() []DetectorParam {
+	return []DetectorParam{
+		{Name: "bucketsPerStep", Description: "Common time buckets count per TimeStep", Default: 1, Min: 1, Max: 1440},
+		{Name: "warningProbability", Description: "Chi-square quantile probability of warnings", Default: 0.99, Min: 0.5, Max: 0.999999},
+		{Name: "alarmProbability", Description: "Chi-square quantile probability of alarms", Default: 0.999, Min: 0.5, Max: 0.999999},
+	}
+}
+
+// CheckParams check alarms chi-square probability is not below warnings one
+func (d MahalanobisDetector) CheckParams(params DetectorParams) error {
+	return CheckParamsOrder(d, params, "warningProbability", "alarmProbability")
+}
+
+// Detect detect outliers of single metric by Mahalanobis distance
+func (d MahalanobisDetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	ds.Metrics = []MetricValues{mv}
+	return d.DetectMetrics(ds, params)
+}
+
+// DetectMetrics detect outliers of all DataSet metrics together by Mahalanobis distance
+func (MahalanobisDetector) DetectMetrics(ds DataSet, params DetectorParams) (*OutlierDetectOutput, error) {
+	return MahalanobisOutlierDetector(ds, params)
+}
+
+// MahalanobisOutlierDetector outlier detection by squared Mahalanobis distance of DataSet metrics aligned onto
+// common time buckets over TimeAgo window, buckets with distance above chi-square quantiles are outliers,
+// metrics are standardized so singularity of their correlation matrix does not depend on metrics scales
+func MahalanobisOutlierDetector(ds DataSet, params DetectorParams) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	aligned, err := ds.AlignMetrics(int(params["bucketsPerStep"]))
+
+	if err != nil {
+		return nil, err
+	}
+	if len(aligned.Rows) <= len(aligned.Metrics) {
+		return nil, errors.New("Not enough buckets for covariance matrix")
+	}
+	k := len(aligned.Metrics)
+	data := mat.NewDense(len(aligned.Rows), k, nil)
+
+	for j := 0; j < k; j++ {
+		column := aligned.Column(j)
+		mean, stDev := stat.MeanStdDev(column, nil)
+
+		if stDev == 0 {
+			return nil, fmt.Errorf("Constant metric %s values", aligned.Metrics[j])
+		}
+		for i := range column {
+			data.Set(i, j, (column[i]-mean)/stDev)
+		}
+	}
+	var cov mat.SymDense
+	var chol mat.Cholesky
+	stat.CovarianceMatrix(&cov, data, nil)
+
+	if !chol.Factorize(&cov) || chol.Cond() > mat.ConditionTolerance {
+		return nil, errors.New("Singular correlation matrix of metrics")
+	}
+	output := ds.MakeOutlierOutput(Mahalanobis, aligned.Window.StartDate, aligned.Window.EndDate)
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	chiSquare := distuv.ChiSquared{K: float64(k)}
+	thresholds := ds.OutliersDetection.Thresholds(
+		chiSquare.Quantile(params["warningProbability"]),
+		chiSquare.Quantile(params["alarmProbability"]),
+	)
+	center := mat.NewVecDense(k, nil)
+	distances := make([]float64, len(aligned.Rows))
+	points := make([]OutlierPoint, len(aligned.Rows))
+
+	for i := range aligned.Rows {
+		dist := stat.Mahalanobis(data.RowView(i), center, &chol)
+		distances[i] = dist * dist
+		level := ds.OutliersDetection.GetThresholdLevel(distances[i], thresholds)
+
+		if level == LevelNone {
+			continue
+		}
+		threshold := thresholds[level-1]
+		points[i] = aligned.DeviatingPoint(i, ds.OutliersDetection.Multipler(1))
+		points[i].Level, points[i].Score, points[i].Threshold = level, distances[i], threshold
+	}
+	output.AddOutliers(MetricValues{Metric: aligned.Label()}, aligned.Values(distances), points)
+	return output, nil
+}
+
+// PeriodOverPeriodDetector same bucket of previous periods comparison Detector
+type PeriodOverPeriodDetector struct{}
+
+// Name return method name
+func (PeriodOverPeriodDetector) Name() string {
+	return PeriodOverPeriod
+}
+
+// Params return method params schema
+func (PeriodOverPeriodDetector) Params() []DetectorParam {
+	return []DetectorParam{
+		{Name: "periodHours", Description: "Compared period length in hours, 168 is week-over-week", Default: 168, Min: 1, Max: 8784},
+		{Name: "periods", Description: "Previous periods count, bucket is compared with their same buckets mean", Default: 1, Min: 1, Max: 52},
+		{Name: "bucketsPerStep", Description: "Compared time buckets count per TimeStep", Default: 24, Min: 1, Max: 1440},
+		{Name: "ratio", Description: "Compare buckets by ratio (1) or difference (0)", Default: 1, Min: 0, Max: 1},
+	}
+}
 
-			if mean, _ := part[start:stop].GetMeanStDev(); mean > alarmUpperLimit {
-				output.Result.Alarms = append(output.Result.Alarms, result)
-			} else {
-				output.Result.Warnings = append(output.Result.Warnings, result)
+// Detect detect outliers by comparison with previous periods
+func (PeriodOverPeriodDetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	return PeriodOverPeriodOutlierDetector(ds, mv, params)
+}
+
+// History return compared previous periods length
+func (PeriodOverPeriodDetector) History(params DetectorParams) time.Duration {
+	return time.Duration(params["periods"]*params["periodHours"]) * time.Hour
+}
+
+// Forecast return previous periods baseline adjusted by median comparison
+func (PeriodOverPeriodDetector) Forecast(ds DataSet, mv MetricValues, params DetectorParams) (DataSetValues, error) {
+	_, actual, baseline, err := FitPeriodOverPeriod(ds, mv, params)
+
+	if err != nil {
+		return nil, err
+	}
+	ratio := params["ratio"] == 1
+	_, median := CompareWithBaseline(actual, baseline, ratio)
+	expected := make(DataSetValues, baseline.Len())
+
+	for i := range baseline {
+		expected[i] = DataSetValue{baseline[i].Date, ApplyComparison(baseline[i].Value, median, ratio)}
+	}
+	return expected, nil
+}
+
+// FitPeriodOverPeriod bucket values by TimeStep/bucketsPerStep, return actual TimeAgo window buckets and
+// their baseline means of the same buckets periods earlier, buckets without baseline and window end date bucket
+// are skipped
+func FitPeriodOverPeriod(ds DataSet, mv MetricValues, params DetectorParams) (window *DetectionWindow, actual, baseline DataSetValues, err error) {
+	window, err = ds.GetDetectionWindow(mv)
+
+	if err != nil {
+		return
+	}
+	bucket := window.TimeStep / time.Duration(params["bucketsPerStep"])
+	period := time.Duration(params["periodHours"]) * time.Hour
+
+	if bucket <= 0 || period%bucket != 0 {
+		return nil, nil, nil, errors.New("Expected period length to be multiple of bucket length")
+	}
+	lag, periods := int(period/bucket), int(params["periods"])
+	start := window.StartDate.Add(-time.Duration(periods) * period)
+	count := int(window.EndDate.Sub(start) / bucket)
+	history := mv.Values.BucketMeans(start, bucket, count)
+	current := window.Values.BucketMeans(start, bucket, count)
+
+	for i := periods * lag; i < count; i++ {
+		var vals []float64
+
+		for p := 1; p <= periods; p++ {
+			vals = append(vals, history[i-p*lag])
+		}
+		vals = SkipNaN(vals...)
+
+		if math.IsNaN(current[i]) || len(vals) == 0 {
+			continue
+		}
+		date := start.Add(time.Duration(i) * bucket)
+		actual = append(actual, DataSetValue{date, current[i]})
+		baseline = append(baseline, DataSetValue{date, Mean(vals...)})
+	}
+	if actual.Len() == 0 {
+		return nil, nil, nil, errors.New("Not enough values for period over period comparison")
+	}
+	return
+}
+
+// CompareWithBaseline get ratios or differences of actual values and baseline with their median,
+// ratios of zero baseline are NaN
+func CompareWithBaseline(actual, baseline DataSetValues, ratio bool) (comparisons []float64, median float64) {
+	comparisons = make([]float64, actual.Len())
+
+	for i := range actual {
+		switch {
+		case !ratio:
+			comparisons[i] = actual[i].Value - baseline[i].Value
+		case baseline[i].Value != 0:
+			comparisons[i] = actual[i].Value / baseline[i].Value
+		default:
+			comparisons[i] = math.NaN()
+		}
+	}
+	if vals := SkipNaN(comparisons...); len(vals) > 0 {
+		median = Median(vals...)
+	} else if ratio {
+		median = 1
+	}
+	return
+}
+
+// ApplyComparison get value of baseline by ratio or difference
+func ApplyComparison(baseline, comparison float64, ratio bool) float64 {
+	if ratio {
+		return baseline * comparison
+	}
+	return baseline + comparison
+}
+
+// PeriodOverPeriodOutlierDetector outlier detection by ratios or differences of every bucket and the same
+// bucket of previous periods, OutliersMultipler and StrongOutliersMultipler are warning and alarm cut-offs
+// in robust standard deviations of all comparisons over TimeAgo window
+func PeriodOverPeriodOutlierDetector(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	window, actual, baseline, err := FitPeriodOverPeriod(ds, mv, params)
+
+	if err != nil {
+		return nil, err
+	}
+	output := ds.MakeOutlierOutput(PeriodOverPeriod, window.StartDate, window.EndDate)
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	ratio := params["ratio"] == 1
+	values, median := CompareWithBaseline(actual, baseline, ratio)
+	_, mad := MedianMAD(SkipNaN(values...)...)
+	stDev := 1.4826 * mad
+
+	if stDev == 0 {
+		return output, nil
+	}
+	points := make([]OutlierPoint, len(values))
+
+	for i := range values {
+		if math.IsNaN(values[i]) {
+			continue
+		}
+		points[i] = ds.MarkOutlier(mv.Metric, values[i], median, stDev)
+
+		if points[i].Level != LevelNone {
+			points[i].Value = actual[i].Value
+			points[i].Expected = ApplyComparison(baseline[i].Value, median, ratio)
+			points[i].Threshold = ApplyComparison(baseline[i].Value, points[i].Threshold, ratio)
+		}
+	}
+	output.AddOutliers(mv, actual, points)
+	return output, nil
+}
+
+// GapsOutlierDetector data gaps detection, metric values are counted in TimeStep/bucketsPerStep buckets of TimeAgo
+// window up to current time and buckets with count below minRatio of median count are gaps of single gap level
+func GapsOutlierDetector(ds DataSet, mv MetricValues) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	timeAgo, timeStep, err := ds.GetTimeAgoAndTimeStepDurations()
+
+	if err != nil {
+		return nil, err
+	}
+	bucketsPerStep, minRatio := ds.Gaps.BucketsPerStep, ds.Gaps.MinRatio
+
+	if bucketsPerStep == 0 {
+		bucketsPerStep = 1
+	}
+	if minRatio == 0 {
+		minRatio = DefaultGapsMinRatio
+	}
+	bucket := timeStep / time.Duration(bucketsPerStep)
+
+	if bucket <= 0 {
+		return nil, errors.New("Too many gaps buckets for TimeStep")
+	}
+	endDate := checkStartTime.Truncate(bucket)
+	startDate := endDate.Add(-timeAgo).Truncate(bucket)
+	count := int(endDate.Sub(startDate) / bucket)
+	counts := mv.Values.CountBuckets(startDate, bucket, count)
+	usual := Median(counts...)
+
+	if usual == 0 {
+		return nil, errors.New("No usual values count for gaps detection")
+	}
+	output := ds.MakeOutlierOutput(Gaps, startDate, endDate)
+	output.Result = OutliersDetectResult{LevelGapName: {}}
+	output.levels, output.keys = []string{LevelGapName}, []string{LevelGapName}
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	threshold := minRatio * usual
+
+	for start := 0; start < count; start++ {
+		if counts[start] >= threshold {
+			continue
+		}
+		stop, fewest := start, counts[start]
+
+		for ; stop < count && counts[stop] < threshold; stop++ {
+			fewest = math.Min(fewest, counts[stop])
+		}
+		output.AddRecord(1, OutlierDetectResultRecord{
+			OutlierPeriodStart: startDate.Add(time.Duration(start) * bucket).Format(DateTimeFormat),
+			OutlierPeriodEnd:   startDate.Add(time.Duration(stop) * bucket).Format(DateTimeFormat),
+			Metric:             mv.Metric,
+			Attribute:          mv.Attribute,
+			Direction:          DirectionDown,
+			Score:              1 - fewest/usual,
+			Peak:               fewest,
+			Expected:           usual,
+			Threshold:          threshold,
+		})
+		start = stop
+	}
+	return output, nil
+}
+
+// BOCPDDetector Bayesian online change-point detection Detector
+type BOCPDDetector struct{}
+
+// Name return method name
+func (BOCPDDetector) Name() string {
+	return BOCPD
+}
+
+// Params return method params schema
+func (BOCPDDetector) Params() []DetectorParam {
+	return []DetectorParam{
+		{Name: "bucketsPerStep", Description: "Series time buckets count per TimeStep", Default: 24, Min: 1, Max: 1440},
+		{Name: "seasonal", Description: "Remove bucket of TimeStep medians before detection (1) or detect raw bucket means (0)", Default: 1, Min: 0, Max: 1},
+		{Name: "hazardBuckets", Description: "Expected regime length in buckets, constant hazard is its inverse", Default: 250, Min: 2, Max: 1e6},
+		{Name: "delay", Description: "Buckets count after change point used to evaluate its probability", Default: 6, Min: 1, Max: 1000},
+		{Name: "warningProbability", Description: "Change point posterior probability of warnings", Default: 0.5, Min: 0, Max: 1},
+		{Name: "alarmProbability", Description: "Change point posterior probability of alarms", Default: 0.8, Min: 0, Max: 1},
+	}
+}
+
+// CheckParams check alarms change point probability is not below warnings one
+func (d BOCPDDetector) CheckParams(params DetectorParams) error {
+	return CheckParamsOrder(d, params, "warningProbability", "alarmProbability")
+}
+
+// Detect detect metric regime change points
+func (BOCPDDetector) Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	return BOCPDOutlierDetector(ds, mv, params)
+}
+
+// BOCPDOutlierDetector change points detection by Bayesian online change-point detection over TimeAgo window
+// values bucketed by TimeStep/bucketsPerStep without window end date bucket and standardized by median and MAD, result records are change points
+// with posterior probability above thresholds, Peak and Expected are mean values after and before change point
+func BOCPDOutlierDetector(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	window, err := ds.GetDetectionWindow(mv)
+
+	if err != nil {
+		return nil, err
+	}
+	output := ds.MakeOutlierOutput(BOCPD, window.StartDate, window.EndDate)
+
+	defer func() {
+		output.CheckTimeStart = checkStartTime.UTC().Format(DateTimeFormat)
+		output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	}()
+
+	bucketsPerStep, delay := int(params["bucketsPerStep"]), int(params["delay"])
+	bucket := window.TimeStep / time.Duration(bucketsPerStep)
+
+	if bucket <= 0 {
+		return nil, errors.New("Too many buckets for TimeStep")
+	}
+	count := int(window.EndDate.Sub(window.StartDate) / bucket)
+	series := window.Values.BucketMeans(window.StartDate, bucket, count)
+	residuals := make([]float64, count)
+	copy(residuals, series)
+
+	if params["seasonal"] == 1 {
+		slots := make([][]float64, bucketsPerStep)
+
+		for i := range series {
+			slots[i%bucketsPerStep] = append(slots[i%bucketsPerStep], series[i])
+		}
+		for i := range residuals {
+			residuals[i] -= Median(SkipNaN(slots[i%bucketsPerStep]...)...)
+		}
+	}
+	median, mad := MedianMAD(SkipNaN(residuals...)...)
+	scale := 1.4826 * mad
+
+	if scale == 0 {
+		return output, nil
+	}
+	for i := range residuals {
+		residuals[i] = (residuals[i] - median) / scale
+	}
+	probs := ChangePointProbabilities(residuals, params["hazardBuckets"], delay)
+	thresholds := ds.OutliersDetection.Thresholds(params["warningProbability"], params["alarmProbability"])
+	var values DataSetValues
+	var points []OutlierPoint
+
+	for i := range series {
+		if math.IsNaN(series[i]) {
+			continue
+		}
+		values = append(values, DataSetValue{window.StartDate.Add(time.Duration(i) * bucket), series[i]})
+		points = append(points, OutlierPoint{Level: LevelNone})
+		level := ds.OutliersDetection.GetThresholdLevel(probs[i], thresholds)
+
+		if level == LevelNone || i == 0 {
+			continue
+		}
+		before := Mean(SkipNaN(series[int(math.Max(0, float64(i-delay))):i]...)...)
+		after := Mean(SkipNaN(series[i:int(math.Min(float64(count), float64(i+delay+1)))]...)...)
+		direction := DirectionUp
+
+		if after < before {
+			direction = DirectionDown
+		}
+		if ds.HasDirection(mv.Metric, direction) {
+			points[len(points)-1] = OutlierPoint{
+				Level:     level,
+				Direction: direction,
+				Score:     probs[i],
+				Value:     after,
+				Expected:  before,
+				Threshold: thresholds[level-1],
 			}
-			start = stop
 		}
 	}
+	output.AddOutliers(mv, values, points)
 	return output, nil
 }
+
+func init() {
+	RegisterDetector(ThreeSigmasDetector{})
+	RegisterDetector(MADDetector{})
+	RegisterDetector(IQRDetector{})
+	RegisterDetector(SeasonalSigmasDetector{})
+	RegisterDetector(EWMADetector{})
+	RegisterDetector(CUSUMDetector{})
+	RegisterDetector(HoltWintersDetector{})
+	RegisterDetector(GESDDetector{})
+	RegisterDetector(IsolationForestDetector{})
+	RegisterDetector(HampelDetector{})
+	RegisterDetector(MahalanobisDetector{})
+	RegisterDetector(PeriodOverPeriodDetector{})
+	RegisterDetector(BOCPDDetector{})
+}
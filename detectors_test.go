@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testStartDate = time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC)
+
+// testSeries make metric values every step from testStartDate
+func testSeries(metric string, count int, step time.Duration, value func(i int) float64) MetricValues {
+	mv := MetricValues{Metric: metric}
+
+	for i := 0; i < count; i++ {
+		mv.Values = append(mv.Values, DataSetValue{testStartDate.Add(time.Duration(i) * step), value(i)})
+	}
+	return mv
+}
+
+// testDataSet make DataSet with default warning and alarm multipliers
+func testDataSet(timeAgo, timeStep string) DataSet {
+	return DataSet{
+		SiteID:            "test",
+		TimeAgo:           timeAgo,
+		TimeStep:          timeStep,
+		OutliersDetection: OutliersDetection{OutliersMultipler: 3, StrongOutliersMultipler: 5},
+	}
+}
+
+// checkEncodable check output records scores are finite and output is encoded to JSON
+func checkEncodable(t *testing.T, out *OutlierDetectOutput) {
+	t.Helper()
+
+	for level, recs := range out.Result {
+		for _, rec := range recs {
+			for _, val := range []float64{rec.Score, rec.Peak, rec.Expected, rec.Threshold} {
+				if math.IsNaN(val) || math.IsInf(val, 0) {
+					t.Errorf("Not finite %s record value: %+v", level, rec)
+				}
+			}
+		}
+	}
+	if _, err := json.Marshal(out); err != nil {
+		t.Errorf("Error encode output: %s", err)
+	}
+}
+
+func TestThreeSigmasOutlierDetectorSingleTimeStep(t *testing.T) {
+	mv := testSeries("Revenue", 24*60, time.Minute, func(i int) float64 {
+		if i >= 600 && i < 620 {
+			return 500
+		}
+		return 100 + float64(i%7)
+	})
+	// value of next day moves window end to the end of the first day, so window has single TimeStep part
+	mv.Values = append(mv.Values, DataSetValue{testStartDate.Add(29 * time.Hour), 100})
+
+	out, err := ThreeSigmasOutlierDetector(testDataSet("1d", "1d"), mv)
+
+	if err != nil {
+		t.Fatalf("Error detect: %s", err)
+	}
+	for level, recs := range out.Result {
+		if len(recs) > 0 {
+			t.Errorf("Expected no %s records without TimeStep parts deviation, got %d", level, len(recs))
+		}
+	}
+	checkEncodable(t, out)
+}
+
+func TestDetectorsKnownOutlier(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	noise := make([]float64, 8*24*60)
+
+	for i := range noise {
+		noise[i] = rnd.NormFloat64()
+	}
+	// outlier starts 10 hours before last value, short outliers alarms are expected within an hour of them
+	at := len(noise) - 10*60
+	first := testStartDate.Add(time.Duration(at) * time.Minute)
+	spike, drop, shift := 3, 3, len(noise)
+
+	tests := []struct {
+		method    string
+		timeAgo   string
+		params    DetectorParams
+		direction string
+		length    int
+		delta     float64
+		scale     float64
+	}{
+		{ThreeSigmas, "1d", nil, DirectionUp, spike, 50, 1},
+		{MAD, "1d", nil, DirectionUp, spike, 50, 1},
+		{MAD, "1d", nil, DirectionDown, drop, -50, 1},
+		{IQR, "1d", nil, DirectionUp, spike, 50, 1},
+		{Seasonal, "7d", nil, DirectionUp, spike, 50, 1},
+		{EWMA, "1d", nil, DirectionUp, spike, 50, 1},
+		{CUSUM, "1d", nil, DirectionUp, shift, 10, 1},
+		{HoltWinters, "1d", nil, DirectionUp, shift, 10, 1},
+		{GESD, "1d", nil, DirectionUp, spike, 50, 1},
+		{GESD, "1d", nil, DirectionDown, drop, -50, 1},
+		{Hampel, "1d", DetectorParams{"width": 1}, DirectionUp, spike, 50, 1},
+		{PeriodOverPeriod, "1d", nil, DirectionUp, spike, 50, 1},
+		{BOCPD, "1d", nil, DirectionUp, shift, 10, 1},
+		{IForest, "1d", nil, DirectionUp, spike, 50, 1},
+		{Mahalanobis, "1d", nil, DirectionUp, spike, 50, 1},
+		{Mahalanobis, "1d", nil, DirectionDown, drop, -50, 1e-9},
+	}
+	for _, tt := range tests {
+		d, err := GetDetector(tt.method)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		params, err := ResolveParams(d, tt.params)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		ds := testDataSet(tt.timeAgo, "1h")
+		ds.Directions = map[string]string{"Revenue": tt.direction}
+		name := tt.method + " " + tt.direction
+		mv := testSeries("Revenue", len(noise), time.Minute, func(i int) float64 {
+			if i >= at && i < at+tt.length {
+				return 100 + tt.delta + 2*noise[i]
+			}
+			return 100 + 2*noise[i]
+		})
+		var out *OutlierDetectOutput
+
+		if m, ok := d.(MultiMetricDetector); ok {
+			ds.Metrics = []MetricValues{mv, testSeries("Orders", len(noise), time.Minute, func(i int) float64 {
+				return tt.scale * (10 + 0.2*noise[(i*7)%len(noise)])
+			})}
+			out, err = m.DetectMetrics(ds, params)
+		} else {
+			out, err = d.Detect(ds, mv, params)
+		}
+		if err != nil {
+			t.Errorf("%s: error detect: %s", name, err)
+			continue
+		}
+		checkEncodable(t, out)
+		alarms := out.Records(2)
+
+		if len(alarms) == 0 {
+			t.Errorf("%s: expected alarm of outlier at %s", name, first)
+			continue
+		}
+		if alarms[0].Direction != tt.direction {
+			t.Errorf("%s: expected alarm direction %s, got %s", name, tt.direction, alarms[0].Direction)
+		}
+		for i, rec := range alarms {
+			start, _ := time.Parse(DateTimeFormat, rec.OutlierPeriodStart)
+			end, _ := time.Parse(DateTimeFormat, rec.OutlierPeriodEnd)
+
+			// bucketed methods records start at bucket before outlier
+			if i == 0 && (start.Before(first.Add(-time.Hour)) || !end.After(first)) {
+				t.Errorf("%s: expected first alarm at outlier %s, got %s - %s", name, first, start, end)
+			}
+			if tt.length != shift && start.After(first.Add(time.Hour)) {
+				t.Errorf("%s: unexpected alarm after outlier %s: %s - %s", name, first, start, end)
+			}
+		}
+	}
+}
+
+func TestGapsOutlierDetector(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Minute)
+	gapStart := now.Add(-5 * time.Hour).Truncate(time.Hour)
+	gapEnd := gapStart.Add(30 * time.Minute)
+	mv := MetricValues{Metric: "Revenue"}
+
+	for date := now.Add(-48 * time.Hour); date.Before(now); date = date.Add(time.Minute) {
+		if date.Before(gapStart) || !date.Before(gapEnd) {
+			mv.Values = append(mv.Values, DataSetValue{date, 100})
+		}
+	}
+	ds := testDataSet("1d", "1h")
+	ds.Gaps = &GapsConfig{BucketsPerStep: 12}
+	out, err := GapsOutlierDetector(ds, mv)
+
+	if err != nil {
+		t.Fatalf("Error detect: %s", err)
+	}
+	gaps := out.Result[LevelGapName]
+
+	if len(gaps) != 1 {
+		t.Fatalf("Expected single gap, got %+v", gaps)
+	}
+	if gaps[0].OutlierPeriodStart != gapStart.Format(DateTimeFormat) || gaps[0].OutlierPeriodEnd != gapEnd.Format(DateTimeFormat) ||
+		gaps[0].Peak != 0 || gaps[0].Expected != 5 || gaps[0].Level != LevelGapName {
+		t.Errorf("Expected gap from %s to %s, got %+v", gapStart, gapEnd, gaps[0])
+	}
+	checkEncodable(t, out)
+}
+
+func TestGESDSignificanceParams(t *testing.T) {
+	d, _ := GetDetector(GESD)
+
+	for _, given := range []DetectorParams{{"alpha": 0}, {"strongAlpha": 0}, {"alpha": 0, "strongAlpha": 0}} {
+		if _, err := ResolveParams(d, given); err == nil {
+			t.Errorf("Expected error of zero significance level %v", given)
+		}
+	}
+	params, err := ResolveParams(d, DetectorParams{"alpha": 1e-12, "strongAlpha": 1e-12})
+
+	if err != nil {
+		t.Fatalf("Error resolve params: %s", err)
+	}
+	rnd := rand.New(rand.NewSource(1))
+	out, err := d.Detect(testDataSet("1d", "1h"), testSeries("Revenue", 24*60, time.Minute, func(i int) float64 {
+		return 100 + rnd.NormFloat64()
+	}), params)
+
+	if err != nil {
+		t.Fatalf("Error detect: %s", err)
+	}
+	for level, recs := range out.Result {
+		if len(recs) > 0 {
+			t.Errorf("Expected no %s records of noise at tiny significance level, got %d", level, len(recs))
+		}
+	}
+}
+
+func TestMultiMetricDetectorsDeviatingMetricsCustomLevels(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	n := 2 * 24 * 60
+	ds := testDataSet("1d", "1h")
+	ds.OutliersDetection = OutliersDetection{Levels: []SeverityLevel{{"warning", 3}, {"alarm", 5}}}
+	ds.Metrics = []MetricValues{
+		testSeries("Revenue", n, time.Minute, func(i int) float64 {
+			if i >= n-10*60 && i < n-10*60+3 {
+				return 150
+			}
+			return 100 + 2*rnd.NormFloat64()
+		}),
+		testSeries("Orders", n, time.Minute, func(i int) float64 { return 10 + 0.2*rnd.NormFloat64() }),
+	}
+	for _, method := range []string{IForest, Mahalanobis} {
+		d, _ := GetDetector(method)
+		params, _ := ResolveParams(d, nil)
+		out, err := d.(MultiMetricDetector).DetectMetrics(ds, params)
+
+		if err != nil {
+			t.Fatalf("%s: error detect: %s", method, err)
+		}
+		alarms := out.Records(2)
+
+		if len(alarms) == 0 || !reflect.DeepEqual(alarms[0].Metrics, []string{"Revenue"}) {
+			t.Errorf("%s: expected alarm of deviating Revenue only, got %+v", method, alarms)
+		}
+	}
+}
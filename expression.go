@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expression arithmetic expression over metrics
+type Expression interface {
+	// Eval evaluate expression by metrics values
+	Eval(vars map[string]float64) float64
+	// Vars get metrics names used in expression
+	Vars() []string
+}
+
+// NumberExpr number literal
+type NumberExpr float64
+
+// VarExpr metric reference
+type VarExpr string
+
+// UnaryExpr negation
+type UnaryExpr struct {
+	X Expression
+}
+
+// BinaryExpr binary arithmetic operation
+type BinaryExpr struct {
+	Op   byte
+	X, Y Expression
+}
+
+// Eval return number value
+func (e NumberExpr) Eval(vars map[string]float64) float64 {
+	return float64(e)
+}
+
+// Vars return nil
+func (e NumberExpr) Vars() []string {
+	return nil
+}
+
+// Eval return metric value
+func (e VarExpr) Eval(vars map[string]float64) float64 {
+	return vars[string(e)]
+}
+
+// Vars return metric name
+func (e VarExpr) Vars() []string {
+	return []string{string(e)}
+}
+
+// Eval return negated value
+func (e UnaryExpr) Eval(vars map[string]float64) float64 {
+	return -e.X.Eval(vars)
+}
+
+// Vars return operand metrics
+func (e UnaryExpr) Vars() []string {
+	return e.X.Vars()
+}
+
+// Eval return operation result, division by zero results in Inf or NaN
+func (e BinaryExpr) Eval(vars map[string]float64) float64 {
+	x, y := e.X.Eval(vars), e.Y.Eval(vars)
+
+	switch e.Op {
+	case '+':
+		return x + y
+	case '-':
+		return x - y
+	case '*':
+		return x * y
+	}
+	return x / y
+}
+
+// Vars return operands metrics
+func (e BinaryExpr) Vars() []string {
+	return UniqueStrings(append(e.X.Vars(), e.Y.Vars()...)...)
+}
+
+// exprParser recursive descent parser of arithmetic expressions
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+// ParseExpression parse arithmetic expression of numbers, metrics names, + - * / and parentheses,
+// like (Revenue - Refunds) / Orders
+func ParseExpression(s string) (Expression, error) {
+	tokens, err := tokenizeExpression(s)
+
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	expr, err := p.parseSum()
+
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("Unexpected token in expression: %s", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+func tokenizeExpression(s string) (tokens []string, err error) {
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("+-*/()", r):
+			tokens = append(tokens, string(r))
+			i++
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.':
+			j := i
+
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			return nil, fmt.Errorf("Invalid character in expression: %c", r)
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("Empty expression")
+	}
+	return tokens, nil
+}
+
+func (p *exprParser) next() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) parseSum() (Expression, error) {
+	x, err := p.parseProduct()
+
+	for err == nil && (p.next() == "+" || p.next() == "-") {
+		op := p.next()[0]
+		p.pos++
+
+		var y Expression
+
+		if y, err = p.parseProduct(); err == nil {
+			x = BinaryExpr{Op: op, X: x, Y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *exprParser) parseProduct() (Expression, error) {
+	x, err := p.parseUnary()
+
+	for err == nil && (p.next() == "*" || p.next() == "/") {
+		op := p.next()[0]
+		p.pos++
+
+		var y Expression
+
+		if y, err = p.parseUnary(); err == nil {
+			x = BinaryExpr{Op: op, X: x, Y: y}
+		}
+	}
+	return x, err
+}
+
+func (p *exprParser) parseUnary() (Expression, error) {
+	if p.next() == "-" {
+		p.pos++
+		x, err := p.parseUnary()
+		return UnaryExpr{X: x}, err
+	}
+	return p.parseOperand()
+}
+
+func (p *exprParser) parseOperand() (Expression, error) {
+	token := p.next()
+	p.pos++
+
+	switch {
+	case token == "":
+		return nil, errors.New("Unexpected end of expression")
+	case token == "(":
+		x, err := p.parseSum()
+
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("Expected ) in expression")
+		}
+		p.pos++
+		return x, nil
+	case unicode.IsDigit(rune(token[0])) || token[0] == '.':
+		val, err := strconv.ParseFloat(token, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number in expression: %s", token)
+		}
+		return NumberExpr(val), nil
+	case strings.ContainsAny(token, "+-*/)"):
+		return nil, fmt.Errorf("Unexpected token in expression: %s", token)
+	}
+	return VarExpr(token), nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseExpression(t *testing.T) {
+	vars := map[string]float64{"Revenue": 100, "Refunds": 20, "Orders": 4}
+	tests := []struct {
+		expr  string
+		value float64
+		vars  []string
+	}{
+		{"Revenue", 100, []string{"Revenue"}},
+		{"2.5", 2.5, nil},
+		{"Revenue - Refunds / Orders", 95, []string{"Revenue", "Refunds", "Orders"}},
+		{"(Revenue - Refunds) / Orders", 20, []string{"Revenue", "Refunds", "Orders"}},
+		{"Revenue - Refunds - Orders", 76, []string{"Revenue", "Refunds", "Orders"}},
+		{"Revenue / Orders / 5", 5, []string{"Revenue", "Orders"}},
+		{"2 + 3 * 4", 14, nil},
+		{"(2 + 3) * 4", 20, nil},
+		{"-Refunds + Revenue", 80, []string{"Refunds", "Revenue"}},
+		{"--Orders", 4, []string{"Orders"}},
+		{"Revenue * -2", -200, []string{"Revenue"}},
+		{"-(Revenue - Refunds) * 2", -160, []string{"Revenue", "Refunds"}},
+		{"((Orders))", 4, []string{"Orders"}},
+		{"Revenue / Revenue * Revenue", 100, []string{"Revenue"}},
+	}
+	for _, tt := range tests {
+		expr, err := ParseExpression(tt.expr)
+
+		if err != nil {
+			t.Errorf("%s: error parse: %s", tt.expr, err)
+			continue
+		}
+		if val := expr.Eval(vars); val != tt.value {
+			t.Errorf("%s: expected %g, got %g", tt.expr, tt.value, val)
+		}
+		if !reflect.DeepEqual(expr.Vars(), tt.vars) {
+			t.Errorf("%s: expected vars %v, got %v", tt.expr, tt.vars, expr.Vars())
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, s := range []string{"", " ", "a +", "(a", "a)", "2x", "a b", "a * / b", "()", "a % b", "1..2", "-"} {
+		if expr, err := ParseExpression(s); err == nil {
+			t.Errorf("Expected error of expression %q, got %#v", s, expr)
+		}
+	}
+}
+
+func TestBinaryExprDivisionByZero(t *testing.T) {
+	expr, _ := ParseExpression("Revenue / Orders")
+
+	if val := expr.Eval(map[string]float64{"Revenue": 1}); !math.IsInf(val, 1) {
+		t.Errorf("Expected +Inf, got %g", val)
+	}
+	if val := expr.Eval(map[string]float64{}); !math.IsNaN(val) {
+		t.Errorf("Expected NaN, got %g", val)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+)
+
+// IsolationForest ensemble of isolation trees
+type IsolationForest struct {
+	Trees      []*IsolationTree
+	SampleSize int
+}
+
+// IsolationTree isolation tree node, leaf when Left and Right are nil
+type IsolationTree struct {
+	Feature int
+	Split   float64
+	Size    int
+	Left    *IsolationTree
+	Right   *IsolationTree
+}
+
+// NewIsolationForest train isolation forest of trees count on random samples of rows
+func NewIsolationForest(rows [][]float64, trees, sampleSize int, rnd *rand.Rand) *IsolationForest {
+	if sampleSize > len(rows) {
+		sampleSize = len(rows)
+	}
+	forest := &IsolationForest{SampleSize: sampleSize}
+	heightLimit := int(math.Ceil(math.Log2(math.Max(float64(sampleSize), 2))))
+
+	for i := 0; i < trees; i++ {
+		sample := make([][]float64, sampleSize)
+
+		for j, indx := range rnd.Perm(len(rows))[:sampleSize] {
+			sample[j] = rows[indx]
+		}
+		forest.Trees = append(forest.Trees, NewIsolationTree(sample, 0, heightLimit, rnd))
+	}
+	return forest
+}
+
+// NewIsolationTree build isolation tree by random feature splits up to height limit
+func NewIsolationTree(rows [][]float64, height, heightLimit int, rnd *rand.Rand) *IsolationTree {
+	node := &IsolationTree{Size: len(rows)}
+
+	if height >= heightLimit || len(rows) <= 1 {
+		return node
+	}
+	features := rnd.Perm(len(rows[0]))
+
+	for _, feature := range features {
+		min, max := rows[0][feature], rows[0][feature]
+
+		for _, row := range rows {
+			min, max = math.Min(min, row[feature]), math.Max(max, row[feature])
+		}
+		if min == max {
+			continue
+		}
+		node.Feature = feature
+		node.Split = min + rnd.Float64()*(max-min)
+
+		var left, right [][]float64
+
+		for _, row := range rows {
+			if row[feature] < node.Split {
+				left = append(left, row)
+			} else {
+				right = append(right, row)
+			}
+		}
+		node.Left = NewIsolationTree(left, height+1, heightLimit, rnd)
+		node.Right = NewIsolationTree(right, height+1, heightLimit, rnd)
+		return node
+	}
+	return node
+}
+
+// PathLength get row isolation path length
+func (t *IsolationTree) PathLength(row []float64) float64 {
+	var height float64
+	node := t
+
+	for node.Left != nil {
+		if row[node.Feature] < node.Split {
+			node = node.Left
+		} else {
+			node = node.Right
+		}
+		height++
+	}
+	return height + AveragePathLength(node.Size)
+}
+
+// Score get row anomaly score 2^(-E(h)/c(n)), scores close to 1 are anomalies
+func (f *IsolationForest) Score(row []float64) float64 {
+	if len(f.Trees) == 0 || f.SampleSize <= 1 {
+		return 0
+	}
+	var sum float64
+
+	for _, t := range f.Trees {
+		sum += t.PathLength(row)
+	}
+	return math.Pow(2, -sum/float64(len(f.Trees))/AveragePathLength(f.SampleSize))
+}
+
+// AveragePathLength average path length of unsuccessful search in binary search tree of n nodes
+func AveragePathLength(n int) float64 {
+	switch {
+	case n <= 1:
+		return 0
+	case n == 2:
+		return 1
+	}
+	return 2*(math.Log(float64(n-1))+0.5772156649) - 2*float64(n-1)/float64(n)
+}
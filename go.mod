@@ -3,6 +3,8 @@ module outliers_detector
 go 1.15
 
 require (
+	github.com/mattn/go-sqlite3 v1.14.16
 	golang.org/x/image v0.0.0-20200618115811-c13761719519
+	gonum.org/v1/gonum v0.8.1
 	gonum.org/v1/plot v0.8.1
 )
@@ -50,10 +50,42 @@ func MakeGraph(ds *DataSet) (p *plot.Plot, err error) {
 		scatter, _ := plotter.NewLine(data)
 		scatter.Color = GetColor(i)
 		p.Add(scatter)
+		AddForecastLines(p, ds, mv, scatter.Color)
 	}
 	return p, err
 }
 
+// AddForecastLines add dashed expected values lines of DataSet forecasting detectors
+func AddForecastLines(p *plot.Plot, ds *DataSet, mv MetricValues, c color.Color) {
+	for _, method := range ds.OutliersDetectionMethod {
+		d, params, err := ds.GetDetector(method)
+
+		if err != nil {
+			continue
+		}
+		forecaster, ok := d.(Forecaster)
+
+		if !ok {
+			continue
+		}
+		expected, err := forecaster.Forecast(*ds, mv, params)
+
+		if err != nil || expected.Len() == 0 {
+			continue
+		}
+		data := xy{make([]float64, expected.Len()), make([]float64, expected.Len())}
+
+		for i := range expected {
+			data.x[i] = float64(expected[i].Date.Unix())
+			data.y[i] = expected[i].Value
+		}
+		line, _ := plotter.NewLine(data)
+		line.Color = c
+		line.Dashes = []vg.Length{vg.Points(4), vg.Points(2)}
+		p.Add(line)
+	}
+}
+
 type xy struct {
 	x []float64
 	y []float64
@@ -3,8 +3,13 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 // DetectOutliersHandler return outliers detection result or DataSet graph
@@ -29,9 +34,15 @@ func DetectOutliersHandler(w http.ResponseWriter, r *http.Request) {
 		WriteResponse(w, 404, "Error get DataSet", err)
 		return
 	}
-	ds.GenerateData()
-
+	if err = ds.LoadData(); err != nil {
+		WriteResponse(w, 500, "Error load DataSet values", err)
+		return
+	}
 	if graph {
+		if err := ds.ResampleMetrics(); err != nil {
+			WriteResponse(w, 500, "Error resample metrics", err)
+			return
+		}
 		pl, err := MakeGraph(ds)
 
 		if err != nil {
@@ -59,6 +70,122 @@ func DetectOutliersHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(body)
 }
 
+// DataSetsHandler route DataSet resources requests, /api/datasets/{siteId}/{values,csv}
+func DataSetsHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/datasets/"), "/"), "/")
+
+	if len(parts) != 2 || parts[0] == "" || (parts[1] != "values" && parts[1] != "csv") {
+		WriteResponse(w, 404, "Not found", errors.New("Expected /api/datasets/{siteId}/values or /api/datasets/{siteId}/csv"))
+		return
+	}
+	ds, err := GetDataSetBySiteID(parts[0])
+
+	if err != nil {
+		WriteResponse(w, 404, "Error get DataSet", err)
+		return
+	}
+	switch {
+	case parts[1] == "values" && r.Method == http.MethodPost:
+		DataSetValuesHandler(w, r, ds)
+	case parts[1] == "csv" && r.Method == http.MethodPost:
+		UploadCSVHandler(w, r, ds)
+	case parts[1] == "csv" && r.Method == http.MethodGet:
+		ExportCSVHandler(w, r, ds)
+	default:
+		WriteResponse(w, 405, "Method not allowed", fmt.Errorf("Unexpected %s method", r.Method))
+	}
+}
+
+// DataSetValuesHandler store values pushed to DataSet as JSON array or NDJSON, POST /api/datasets/{siteId}/values
+func DataSetValuesHandler(w http.ResponseWriter, r *http.Request, ds *DataSet) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxIngestBodyBytes))
+
+	if err != nil {
+		WriteResponse(w, 400, "Error read request body", err)
+		return
+	}
+	values, err := DecodeIngestedValues(body)
+
+	if err != nil {
+		WriteResponse(w, 400, "Error decode values", err)
+		return
+	}
+	lines, err := EncodeIngestedValues(*ds, values)
+
+	if err != nil {
+		WriteResponse(w, 400, "Invalid values", err)
+		return
+	}
+	if err = SaveIngestedValues(*ds, lines); err != nil {
+		WriteResponse(w, 500, "Error save values", err)
+		return
+	}
+	WriteResponse(w, 200, fmt.Sprintf("Stored %d values", len(values)), nil)
+}
+
+// UploadCSVHandler store DataSet values of CSV file, as multipart form file field or request body,
+// POST /api/datasets/{siteId}/csv?timeFormat=&delimiter=
+func UploadCSVHandler(w http.ResponseWriter, r *http.Request, ds *DataSet) {
+	format, err := NewCSVFormat(r.URL.Query().Get("timeFormat"), r.URL.Query().Get("delimiter"))
+
+	if err != nil {
+		WriteResponse(w, 400, "Invalid CSV format", err)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxIngestBodyBytes)
+	var body io.Reader = r.Body
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+
+		if err != nil {
+			WriteResponse(w, 400, "Error get CSV file", err)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+	metrics, err := ReadMetricsCSV(body, format)
+
+	if err != nil {
+		WriteResponse(w, 400, "Error read CSV", err)
+		return
+	}
+	values := MetricsIngestedValues(metrics)
+	lines, err := EncodeIngestedValues(*ds, values)
+
+	if err != nil {
+		WriteResponse(w, 400, "Invalid values", err)
+		return
+	}
+	if err = SaveIngestedValues(*ds, lines); err != nil {
+		WriteResponse(w, 500, "Error save values", err)
+		return
+	}
+	WriteResponse(w, 200, fmt.Sprintf("Stored %d values", len(values)), nil)
+}
+
+// ExportCSVHandler return DataSet values as CSV, GET /api/datasets/{siteId}/csv?timeFormat=&delimiter=
+func ExportCSVHandler(w http.ResponseWriter, r *http.Request, ds *DataSet) {
+	format, err := NewCSVFormat(r.URL.Query().Get("timeFormat"), r.URL.Query().Get("delimiter"))
+
+	if err != nil {
+		WriteResponse(w, 400, "Invalid CSV format", err)
+		return
+	}
+	if err = ds.LoadData(); err != nil {
+		WriteResponse(w, 500, "Error load DataSet values", err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", ds.SiteID+".csv"))
+
+	if err = WriteMetricsCSV(w, ds.Metrics, format); err != nil {
+		log.Printf("Error export DataSet %s CSV: %s\n", ds.SiteID, err.Error())
+	}
+}
+
 func init() {
 	http.HandleFunc("/api/detect_outliers", DetectOutliersHandler)
+	http.HandleFunc("/api/datasets/", DataSetsHandler)
 }
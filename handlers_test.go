@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testStoreDataSet make DataSet with values store in temporary directory restored after test
+func testStoreDataSet(t *testing.T, siteID string) DataSet {
+	t.Helper()
+	ds := testDataSet("1d", "1h")
+	ds.SiteID, ds.MetricesList = siteID, []string{"Revenue", "Orders"}
+	valuesDir := ValuesDir
+	ValuesDir = t.TempDir() + "/"
+
+	t.Cleanup(func() {
+		ValuesDir = valuesDir
+	})
+	return ds
+}
+
+func TestDataSetValuesHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"array", `[{"metric": "Revenue", "date": "2021-01-04 10:00:00", "value": 10}]`, 200},
+		{"ndjson", "{\"metric\": \"Orders\", \"attribute\": \"country=DE\", \"date\": \"2021-01-04T11:00:00Z\", \"value\": 2}\n" +
+			"{\"metric\": \"Revenue\", \"date\": \"2021-01-04 11:00:00\", \"value\": 12}\n", 200},
+		{"invalid json", `[{"metric": "Revenue",`, 400},
+		{"unknown metric", `[{"metric": "Visitors", "date": "2021-01-04 10:00:00", "value": 1}]`, 400},
+		{"invalid date", `[{"metric": "Revenue", "date": "04.01.2021", "value": 1}]`, 400},
+	}
+	ds := testStoreDataSet(t, "values-handler-test")
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		DataSetValuesHandler(w, httptest.NewRequest("POST", "/api/datasets/values-handler-test/values", strings.NewReader(tt.body)), &ds)
+
+		if w.Code != tt.code {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.code, w.Code, w.Body.String())
+		}
+	}
+	metrics, err := LoadIngestedValues(ds.SiteID, time.Time{})
+
+	if err != nil {
+		t.Fatalf("Error load values: %s", err)
+	}
+	counts := make(map[string]int)
+
+	for _, mv := range metrics {
+		counts[mv.Metric+"/"+mv.Attribute] += mv.Values.Len()
+	}
+	if len(counts) != 2 || counts["Revenue/"] != 2 || counts["Orders/country=DE"] != 1 {
+		t.Errorf("Expected stored values of valid requests only, got %v", counts)
+	}
+}
+
+func TestDataSetValuesHandlerStoreError(t *testing.T) {
+	ds := testStoreDataSet(t, "values-handler-store-error-test")
+
+	// directory in place of values store file fails store writes
+	if err := os.MkdirAll(ValuesDir+ds.SiteID+".ndjson", 0755); err != nil {
+		t.Fatalf("Error create directory: %s", err)
+	}
+	w := httptest.NewRecorder()
+	body := `[{"metric": "Revenue", "date": "2021-01-04 10:00:00", "value": 10}]`
+	DataSetValuesHandler(w, httptest.NewRequest("POST", "/api/datasets/x/values", strings.NewReader(body)), &ds)
+
+	if w.Code != 500 {
+		t.Errorf("Expected status 500 of store error, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// testMultipartCSV make multipart form body with CSV file field
+func testMultipartCSV(t *testing.T, csv string) (*bytes.Buffer, string) {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", "values.csv")
+
+	if err != nil {
+		t.Fatalf("Error create form file: %s", err)
+	}
+	part.Write([]byte(csv))
+
+	if err = writer.Close(); err != nil {
+		t.Fatalf("Error close multipart writer: %s", err)
+	}
+	return body, writer.FormDataContentType()
+}
+
+func TestUploadCSVHandler(t *testing.T) {
+	csv := "timestamp,metric,attribute,value\n2021-01-04 10:00:00,Revenue,,10\n2021-01-04 11:00:00,Orders,country=DE,2\n"
+	tests := []struct {
+		name      string
+		multipart bool
+		csv       string
+		code      int
+	}{
+		{"multipart", true, csv, 200},
+		{"body", false, csv, 200},
+		{"invalid value", false, "2021-01-04 10:00:00,Revenue,,ten\n", 400},
+		{"unknown metric", true, "2021-01-04 10:00:00,Visitors,,1\n", 400},
+		{"oversized multipart", true, csv + strings.Repeat("2021-01-04 12:00:00,Revenue,,1\n", MaxIngestBodyBytes/30), 400},
+	}
+	ds := testStoreDataSet(t, "csv-handler-test")
+
+	for _, tt := range tests {
+		body, contentType := bytes.NewBufferString(tt.csv), "text/csv"
+
+		if tt.multipart {
+			body, contentType = testMultipartCSV(t, tt.csv)
+		}
+		r := httptest.NewRequest("POST", "/api/datasets/csv-handler-test/csv", body)
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		UploadCSVHandler(w, r, &ds)
+
+		if w.Code != tt.code {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.name, tt.code, w.Code, w.Body.String())
+		}
+	}
+	metrics, err := LoadIngestedValues(ds.SiteID, time.Time{})
+
+	if err != nil {
+		t.Fatalf("Error load values: %s", err)
+	}
+	count := 0
+
+	for _, mv := range metrics {
+		count += mv.Values.Len()
+	}
+	if count != 4 {
+		t.Errorf("Expected 4 stored values of valid uploads only, got %d", count)
+	}
+}
@@ -2,21 +2,48 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"math/rand"
+	"sort"
+	"strings"
 	"time"
 )
 
 // GetMeanStDev get mean and standart deviation values
 func (dsv DataSetValues) GetMeanStDev() (float64, float64) {
-	vals := make([]float64, dsv.Len())
+	return MeanStDev(dsv.GetValues()...)
+}
 
-	for i := range dsv {
-		vals[i] = dsv[i].Value
+// GetMedianMAD get median and median absolute deviation values
+func (dsv DataSetValues) GetMedianMAD() (float64, float64) {
+	return MedianMAD(dsv.GetValues()...)
+}
+
+// LoadData fetch DataSet metrics values of values retention from DataSet source, so detectors get TimeAgo window
+// and their history
+func (ds *DataSet) LoadData() error {
+	source, err := NewDataSource(ds.Source)
+
+	if err != nil {
+		return err
+	}
+	retention, err := ds.ValuesRetention()
+
+	if err != nil {
+		return err
+	}
+	end := time.Now().UTC()
+	metrics, err := source.Fetch(*ds, end.Add(-retention), end)
+
+	if err != nil {
+		return fmt.Errorf("Error fetch %s source values: %s", ds.Source.Type, err)
 	}
-	return MeanStDev(vals...)
+	ds.Metrics = metrics
+	return nil
 }
 
 // GenerateData generate DataSet values
@@ -33,7 +60,210 @@ func (ds *DataSet) GenerateData() {
 			mv.Values = append(mv.Values, DataSetValue{dt, val})
 		}
 		ds.Metrics = append(ds.Metrics, mv)
+		ds.GenerateAttributesData(mv)
+	}
+}
+
+// GenerateAttributesData generate DataSet metric attributes values by splitting total values
+// between every dimension values with random weights
+func (ds *DataSet) GenerateAttributesData(total MetricValues) {
+	dimensions := make([]string, 0, len(ds.Dimensions))
+
+	for dimension := range ds.Dimensions {
+		dimensions = append(dimensions, dimension)
+	}
+	sort.Strings(dimensions)
+
+	for _, dimension := range dimensions {
+		values := ds.Dimensions[dimension]
+		weights := make([]float64, len(values))
+		var sum float64
+
+		for i := range weights {
+			weights[i] = rand.Float64() + 0.1
+			sum += weights[i]
+		}
+		for i, value := range values {
+			mv := MetricValues{Metric: total.Metric, Attribute: AttributeLabel(dimension, value)}
+
+			for _, v := range total.Values {
+				noise := 0.9 + rand.Float64()*0.2
+				mv.Values = append(mv.Values, DataSetValue{v.Date, v.Value * weights[i] / sum * noise})
+			}
+			ds.Metrics = append(ds.Metrics, mv)
+		}
+	}
+}
+
+// ResampleMetrics resample DataSet metrics and their attributes values into regular buckets by metrics Resampling
+func (ds *DataSet) ResampleMetrics() error {
+	metrics := make([]MetricValues, len(ds.Metrics))
+
+	for i, mv := range ds.Metrics {
+		metrics[i] = mv
+		rc, ok := ds.Resampling[mv.Metric]
+
+		if !ok {
+			continue
+		}
+		bucket, err := ParseDuration(rc.Bucket)
+
+		if err != nil {
+			return fmt.Errorf("Error parse resampling bucket of %s: %s", mv.Metric, err)
+		}
+		metrics[i].Values = mv.Values.Resample(bucket, rc.Aggregation, rc.Empty)
+	}
+	ds.Metrics = metrics
+	return nil
+}
+
+// AddDerivedMetrics evaluate DataSet derived metrics expressions per aligned time bucket of operands values,
+// in total and per attribute present in all operands
+func (ds *DataSet) AddDerivedMetrics() error {
+	buckets := ds.DerivedBucketsPerStep
+
+	if buckets == 0 {
+		buckets = DefaultDerivedBucketsPerStep
+	}
+	var derived []MetricValues
+	names := make([]string, 0, len(ds.DerivedMetrics))
+
+	for name := range ds.DerivedMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		expr, err := ParseExpression(ds.DerivedMetrics[name])
+
+		if err != nil {
+			return fmt.Errorf("Error parse derived metric %s: %s", name, err)
+		}
+		for _, attribute := range ds.CommonAttributes(expr.Vars()) {
+			operands := *ds
+			operands.Metrics = ds.FindMetrics(expr.Vars(), attribute)
+			aligned, err := operands.AlignMetrics(buckets)
+
+			if err != nil {
+				continue
+			}
+			mv := MetricValues{Metric: name, Attribute: attribute}
+
+			for i, row := range aligned.Rows {
+				vars := make(map[string]float64, len(row))
+
+				for j, metric := range aligned.Metrics {
+					vars[metric] = row[j]
+				}
+				if val := expr.Eval(vars); !math.IsNaN(val) && !math.IsInf(val, 0) {
+					mv.Values = append(mv.Values, DataSetValue{aligned.Dates[i], val})
+				}
+			}
+			if mv.Values.Len() > 0 {
+				derived = append(derived, mv)
+			}
+		}
 	}
+	ds.Metrics = append(ds.Metrics, derived...)
+	return nil
+}
+
+// CommonAttributes get attributes present in all given metrics values, including total ("")
+func (ds DataSet) CommonAttributes(metrics []string) (attributes []string) {
+	counts := make(map[string]int)
+
+	for _, mv := range ds.Metrics {
+		for _, metric := range metrics {
+			if mv.Metric == metric {
+				if counts[mv.Attribute]++; counts[mv.Attribute] == len(metrics) {
+					attributes = append(attributes, mv.Attribute)
+				}
+			}
+		}
+	}
+	return
+}
+
+// FindMetrics get values of given metrics with attribute
+func (ds DataSet) FindMetrics(metrics []string, attribute string) (found []MetricValues) {
+	for _, metric := range metrics {
+		for _, mv := range ds.Metrics {
+			if mv.Metric == metric && mv.Attribute == attribute {
+				found = append(found, mv)
+				break
+			}
+		}
+	}
+	return
+}
+
+// TotalMetrics get DataSet metrics total values, without attributes
+func (ds DataSet) TotalMetrics() (metrics []MetricValues) {
+	for _, mv := range ds.Metrics {
+		if mv.Attribute == "" {
+			metrics = append(metrics, mv)
+		}
+	}
+	return
+}
+
+// AttributeMetrics get metric attributes values of DataSet dimensions,
+// top DimensionsTopN attributes by volume of every dimension
+func (ds DataSet) AttributeMetrics(metric string) (metrics []MetricValues) {
+	byDimension := make(map[string][]MetricValues)
+
+	for _, mv := range ds.Metrics {
+		if mv.Metric != metric || mv.Attribute == "" {
+			continue
+		}
+		dimension := AttributeDimension(mv.Attribute)
+
+		if _, ok := ds.Dimensions[dimension]; ok {
+			byDimension[dimension] = append(byDimension[dimension], mv)
+		}
+	}
+	topN := ds.DimensionsTopN
+
+	if topN == 0 {
+		topN = DefaultDimensionsTopN
+	}
+	dimensions := make([]string, 0, len(byDimension))
+
+	for dimension := range byDimension {
+		dimensions = append(dimensions, dimension)
+	}
+	sort.Strings(dimensions)
+
+	for _, dimension := range dimensions {
+		attributes := byDimension[dimension]
+
+		sort.SliceStable(attributes, func(i, j int) bool {
+			return attributes[i].Values.Sum() > attributes[j].Values.Sum()
+		})
+		if len(attributes) > topN {
+			attributes = attributes[:topN]
+		}
+		metrics = append(metrics, attributes...)
+	}
+	return
+}
+
+// Peak return DataSetValues extreme value in direction of sign, maximal for 1 and minimal for -1
+func (dsv DataSetValues) Peak(sign float64) (peak float64) {
+	for i, v := range dsv {
+		if i == 0 || sign*v.Value > sign*peak {
+			peak = v.Value
+		}
+	}
+	return
+}
+
+// Sum return DataSetValues values sum
+func (dsv DataSetValues) Sum() (sum float64) {
+	for _, v := range dsv {
+		sum += v.Value
+	}
+	return
 }
 
 // BreakIntoPieces break DataSetValues into pices by timeStep duration
@@ -80,46 +310,866 @@ func (ds DataSet) GetTimeAgoAndTimeStepDurations() (timeAgo, timeStep time.Durat
 	return
 }
 
+// ValuesRetention get age of values used by DataSet detection, TimeAgo window with TimeStep margin
+// and the longest history of DataSet methods
+func (ds DataSet) ValuesRetention() (time.Duration, error) {
+	timeAgo, timeStep, err := ds.GetTimeAgoAndTimeStepDurations()
+
+	if err != nil {
+		return 0, err
+	}
+	var history time.Duration
+	methods := ds.OutliersDetectionMethod
+
+	if ds.Ensemble != nil {
+		methods = append(append([]string{}, methods...), ds.Ensemble.Methods...)
+	}
+	for _, method := range methods {
+		d, params, err := ds.GetDetector(method)
+
+		if err != nil {
+			return 0, err
+		}
+		if h, ok := d.(HistoryDetector); ok && h.History(params) > history {
+			history = h.History(params)
+		}
+	}
+	return timeAgo + timeStep + history, nil
+}
+
+// GetDetectionWindow get metric values within TimeAgo window filtered by minimal detect value
+func (ds DataSet) GetDetectionWindow(mv MetricValues) (*DetectionWindow, error) {
+	if len(mv.Values) == 0 {
+		return nil, errors.New("Empty values")
+	}
+	timeAgo, timeStep, err := ds.GetTimeAgoAndTimeStepDurations()
+
+	if err != nil {
+		return nil, err
+	}
+	endDate := mv.Values[mv.Values.Len()-1].Date.Truncate(timeStep)
+	startDate := endDate.Add(-timeAgo).Round(timeStep)
+
+	minDetectionValue := float64(timeStep / timeAgo * time.Duration(ds.MinVisitorsPerTimeStep))
+	values := mv.Values.FilterByDatesAndMinValue(startDate, endDate, minDetectionValue)
+
+	if values.Len() == 0 {
+		return nil, errors.New("No available values for detecting")
+	}
+	return &DetectionWindow{
+		StartDate: startDate,
+		EndDate:   endDate,
+		TimeAgo:   timeAgo,
+		TimeStep:  timeStep,
+		Values:    values,
+	}, nil
+}
+
+// CountBuckets get values counts of count regular buckets from start date
+func (dsv DataSetValues) CountBuckets(start time.Time, bucket time.Duration, count int) []float64 {
+	counts := make([]float64, count)
+
+	for _, v := range dsv {
+		if i := int(v.Date.Sub(start) / bucket); !v.Date.Before(start) && i < count {
+			counts[i]++
+		}
+	}
+	return counts
+}
+
+// Resample convert DataSetValues into regular buckets series aggregated by aggregation function,
+// empty buckets are handled by empty handling and skipped when no value is filled, the bucket of the latest
+// value is still filling and is dropped
+func (dsv DataSetValues) Resample(bucket time.Duration, aggregation, empty string) (resampled DataSetValues) {
+	if dsv.Len() == 0 {
+		return
+	}
+	start := dsv[0].Date.Truncate(bucket)
+	count := int(dsv[dsv.Len()-1].Date.Sub(start) / bucket)
+	groups := make([][]float64, count)
+
+	for _, v := range dsv {
+		if i := int(v.Date.Sub(start) / bucket); !v.Date.Before(start) && i < count {
+			groups[i] = append(groups[i], v.Value)
+		}
+	}
+	vals := make([]float64, count)
+
+	for i := range groups {
+		vals[i] = math.NaN()
+
+		if len(groups[i]) > 0 {
+			vals[i] = Aggregate(aggregation, groups[i]...)
+		}
+	}
+	FillEmpty(vals, empty)
+
+	for i := range vals {
+		if !math.IsNaN(vals[i]) {
+			resampled = append(resampled, DataSetValue{start.Add(time.Duration(i) * bucket), vals[i]})
+		}
+	}
+	return
+}
+
+// GetValues return DataSetValues values
+func (dsv DataSetValues) GetValues() []float64 {
+	vals := make([]float64, dsv.Len())
+
+	for i := range dsv {
+		vals[i] = dsv[i].Value
+	}
+	return vals
+}
+
+// BucketMeans get mean values of count regular buckets from start date, NaN for empty buckets
+func (dsv DataSetValues) BucketMeans(start time.Time, bucket time.Duration, count int) []float64 {
+	sums := make([]float64, count)
+	counts := make([]int, count)
+
+	for _, v := range dsv {
+		if i := int(v.Date.Sub(start) / bucket); i >= 0 && i < count {
+			sums[i] += v.Value
+			counts[i]++
+		}
+	}
+	for i := range sums {
+		if counts[i] == 0 {
+			sums[i] = math.NaN()
+		} else {
+			sums[i] /= float64(counts[i])
+		}
+	}
+	return sums
+}
+
+// AlignMetrics align DataSet metrics TimeAgo window values onto common buckets of TimeStep/bucketsPerStep size
+// by their mean values, only buckets having values of all metrics are kept, values at window end date are out of
+// buckets, so last bucket is not partial
+func (ds DataSet) AlignMetrics(bucketsPerStep int) (*AlignedMetrics, error) {
+	if len(ds.Metrics) == 0 {
+		return nil, errors.New("Empty metrics")
+	}
+	aligned := &AlignedMetrics{}
+	var series [][]float64
+	var count int
+	var bucket time.Duration
+
+	for _, mv := range ds.Metrics {
+		window, err := ds.GetDetectionWindow(mv)
+
+		if err != nil {
+			return nil, fmt.Errorf("Error get metric %s values: %s", mv.Metric, err)
+		}
+		if aligned.Window == nil {
+			aligned.Window = window
+			bucket = window.TimeStep / time.Duration(bucketsPerStep)
+
+			if bucket <= 0 {
+				return nil, errors.New("Too many buckets per TimeStep")
+			}
+			count = int(window.EndDate.Sub(window.StartDate) / bucket)
+		}
+		aligned.Metrics = append(aligned.Metrics, mv.Metric)
+		series = append(series, window.Values.BucketMeans(aligned.Window.StartDate, bucket, count))
+	}
+
+	for i := 0; i < count; i++ {
+		row := make([]float64, len(series))
+
+		for j := range series {
+			row[j] = series[j][i]
+		}
+		if len(SkipNaN(row...)) == len(row) {
+			aligned.Dates = append(aligned.Dates, aligned.Window.StartDate.Add(time.Duration(i)*bucket))
+			aligned.Rows = append(aligned.Rows, row)
+		}
+	}
+	if len(aligned.Rows) == 0 {
+		return nil, errors.New("No common buckets of metrics values")
+	}
+	return aligned, nil
+}
+
+// Label get combined label of aligned metrics
+func (am AlignedMetrics) Label() string {
+	return strings.Join(am.Metrics, "+")
+}
+
+// Column get aligned values of metric by index
+func (am AlignedMetrics) Column(i int) []float64 {
+	column := make([]float64, len(am.Rows))
+
+	for j := range am.Rows {
+		column[j] = am.Rows[j][i]
+	}
+	return column
+}
+
+// Values get aligned buckets dates as DataSetValues with given values
+func (am AlignedMetrics) Values(vals []float64) DataSetValues {
+	values := make(DataSetValues, len(am.Dates))
+
+	for i := range am.Dates {
+		values[i] = DataSetValue{am.Dates[i], vals[i]}
+	}
+	return values
+}
+
+// DeviatingPoint get outlier point of row with metrics deviating from their columns medians more than
+// multipler robust standard deviations, or the most deviating one, and direction, value and median
+// of the most deviating one
+func (am AlignedMetrics) DeviatingPoint(row int, multipler float64) (point OutlierPoint) {
+	var maxScore float64
+	var maxMetric string
+	point.Direction = DirectionUp
+
+	for i, metric := range am.Metrics {
+		median, mad := MedianMAD(am.Column(i)...)
+
+		if mad == 0 {
+			continue
+		}
+		score := (am.Rows[row][i] - median) / (1.4826 * mad)
+
+		if math.Abs(score) > multipler {
+			point.Metrics = append(point.Metrics, metric)
+		}
+		if math.Abs(score) > maxScore {
+			maxScore, maxMetric = math.Abs(score), metric
+			point.Value, point.Expected, point.Direction = am.Rows[row][i], median, DirectionUp
+
+			if score < 0 {
+				point.Direction = DirectionDown
+			}
+		}
+	}
+	if len(point.Metrics) == 0 && maxMetric != "" {
+		point.Metrics = append(point.Metrics, maxMetric)
+	}
+	return
+}
+
+// GroupBySeasonalSlot group values by hour-of-day (and weekday) slots
+func (dsv DataSetValues) GroupBySeasonalSlot(weekday bool) map[int][]float64 {
+	slots := make(map[int][]float64)
+
+	for _, v := range dsv {
+		slot := SeasonalSlot(v.Date, weekday)
+		slots[slot] = append(slots[slot], v.Value)
+	}
+	return slots
+}
+
+// AddOutliers group consecutive outlying values of the same direction into periods
+func (o *OutlierDetectOutput) AddOutliers(mv MetricValues, values DataSetValues, points []OutlierPoint) {
+	for start := 0; start < len(points); start++ {
+		if points[start].Level == LevelNone {
+			continue
+		}
+		stop, level, direction := start, LevelNone, points[start].Direction
+		top, peak := points[start], points[start].Value
+		sign := DirectionSign(direction)
+
+		for stop < len(points) && points[stop].Level != LevelNone && points[stop].Direction == direction {
+			if points[stop].Level > level {
+				level = points[stop].Level
+			}
+			if points[stop].Score > top.Score {
+				top = points[stop]
+			}
+			if sign*points[stop].Value > sign*peak {
+				peak = points[stop].Value
+			}
+			stop++
+		}
+		periodStart, periodEnd := values[start].Date, values[stop-1].Date
+		metrics := PointsMetrics(points[start:stop])
+
+		if start > 0 {
+			periodStart = values[start-1].Date
+		}
+		if stop < values.Len() {
+			periodEnd = values[stop].Date
+		}
+		o.AddRecord(level, OutlierDetectResultRecord{
+			OutlierPeriodStart: periodStart.Format(DateTimeFormat),
+			OutlierPeriodEnd:   periodEnd.Format(DateTimeFormat),
+			Metric:             mv.Metric,
+			Attribute:          mv.Attribute,
+			Direction:          direction,
+			Metrics:            metrics,
+			Score:              top.Score,
+			Peak:               peak,
+			Expected:           top.Expected,
+			Threshold:          top.Threshold,
+		})
+		start = stop - 1
+	}
+}
+
+// AddRecord add outlier record to result by level
+func (o *OutlierDetectOutput) AddRecord(level int, rec OutlierDetectResultRecord) {
+	if level < 1 || level > len(o.levels) {
+		return
+	}
+	rec.Level = o.levels[level-1]
+	o.Result[o.keys[level-1]] = append(o.Result[o.keys[level-1]], rec)
+}
+
+// Records get result records of outlier level
+func (o OutlierDetectOutput) Records(level int) []OutlierDetectResultRecord {
+	if level < 1 || level > len(o.keys) {
+		return nil
+	}
+	return o.Result[o.keys[level-1]]
+}
+
+// LevelIndex get outlier level by severity level name
+func (o OutlierDetectOutput) LevelIndex(name string) int {
+	for i := range o.levels {
+		if o.levels[i] == name {
+			return i + 1
+		}
+	}
+	return LevelNone
+}
+
+// GetLevels get severity levels ordered by multipler, warning and alarm levels by default
+func (od OutliersDetection) GetLevels() []SeverityLevel {
+	if len(od.Levels) > 0 {
+		return od.Levels
+	}
+	return []SeverityLevel{
+		{Name: LevelWarningName, Multipler: od.OutliersMultipler},
+		{Name: LevelAlarmName, Multipler: od.StrongOutliersMultipler},
+	}
+}
+
+// LevelsNames get severity levels names
+func (od OutliersDetection) LevelsNames() []string {
+	levels := od.GetLevels()
+	names := make([]string, len(levels))
+
+	for i := range levels {
+		names[i] = levels[i].Name
+	}
+	return names
+}
+
+// ResultKeys get severity levels result keys, Warnings and Alarms for default levels
+func (od OutliersDetection) ResultKeys() []string {
+	if len(od.Levels) > 0 {
+		return od.LevelsNames()
+	}
+	return []string{ResultWarningsKey, ResultAlarmsKey}
+}
+
+// GetLevel get outlier level of score, the highest level with multipler exceeded by score
+func (od OutliersDetection) GetLevel(score float64) int {
+	levels := od.GetLevels()
+	thresholds := make([]float64, len(levels))
+
+	for i := range levels {
+		thresholds[i] = levels[i].Multipler
+	}
+	return od.GetThresholdLevel(score, thresholds)
+}
+
+// GetThresholdLevel get outlier level of score by levels thresholds, the highest level with threshold exceeded
+func (od OutliersDetection) GetThresholdLevel(score float64, thresholds []float64) int {
+	level := LevelNone
+
+	for i := range thresholds {
+		if score > thresholds[i] {
+			level = i + 1
+		}
+	}
+	return level
+}
+
+// Multipler get multipler of outlier level
+func (od OutliersDetection) Multipler(level int) float64 {
+	levels := od.GetLevels()
+
+	if level < 1 || level > len(levels) {
+		return 0
+	}
+	return levels[level-1].Multipler
+}
+
+// Thresholds get levels thresholds of detector with own first and last level thresholds, intermediate levels
+// thresholds are interpolated proportionally to levels multipliers
+func (od OutliersDetection) Thresholds(first, last float64) []float64 {
+	levels := od.GetLevels()
+	thresholds := make([]float64, len(levels))
+
+	for i := range levels {
+		thresholds[i] = first
+
+		if span := levels[len(levels)-1].Multipler - levels[0].Multipler; span > 0 {
+			thresholds[i] += (last - first) * (levels[i].Multipler - levels[0].Multipler) / span
+		}
+	}
+	return thresholds
+}
+
+// GetDirections get detection directions of DataSet metric, up by default
+func (ds DataSet) GetDirections(metric string) []string {
+	switch ds.Directions[metric] {
+	case DirectionDown:
+		return []string{DirectionDown}
+	case DirectionBoth:
+		return []string{DirectionUp, DirectionDown}
+	}
+	return []string{DirectionUp}
+}
+
+// HasDirection check DataSet metric detection direction
+func (ds DataSet) HasDirection(metric, direction string) bool {
+	for _, d := range ds.GetDirections(metric) {
+		if d == direction {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkOutlier get outlier point of value deviation from expected value in scale units by DataSet metric
+// directions, threshold is expected value shifted by crossed level multipler scales
+func (ds DataSet) MarkOutlier(metric string, value, expected, scale float64) OutlierPoint {
+	for _, direction := range ds.GetDirections(metric) {
+		sign := DirectionSign(direction)
+		score := sign * (value - expected) / scale
+
+		if level := ds.OutliersDetection.GetLevel(score); level != LevelNone {
+			return OutlierPoint{
+				Level:     level,
+				Direction: direction,
+				Score:     score,
+				Value:     value,
+				Expected:  expected,
+				Threshold: expected + sign*ds.OutliersDetection.Multipler(level)*scale,
+			}
+		}
+	}
+	return OutlierPoint{Level: LevelNone}
+}
+
 // MakeOutlierOutput returns OutlierDetectOutput
-func (ds DataSet) MakeOutlierOutput(startDate, endDate time.Time) *OutlierDetectOutput {
+func (ds DataSet) MakeOutlierOutput(method string, startDate, endDate time.Time) *OutlierDetectOutput {
 	return &OutlierDetectOutput{
 		SiteID:                  ds.SiteID,
 		TimeAgo:                 ds.TimeAgo,
 		TimeStep:                ds.TimeStep,
-		OutliersDetectionMethod: ThreeSigmas,
+		OutliersDetectionMethod: method,
 		DateStart:               startDate.Format(DateTimeFormat),
 		DateEnd:                 endDate.Format(DateTimeFormat),
-		Result: OutliersDetectResult{
-			Warnings: make([]OutlierDetectResultRecord, 0),
-			Alarms:   make([]OutlierDetectResultRecord, 0),
-		},
+		Result:                  ds.OutliersDetection.MakeResult(),
+		levels:                  ds.OutliersDetection.LevelsNames(),
+		keys:                    ds.OutliersDetection.ResultKeys(),
 	}
+}
+
+// MakeResult returns OutliersDetectResult with empty records of every severity level
+func (od OutliersDetection) MakeResult() OutliersDetectResult {
+	result := make(OutliersDetectResult)
 
+	for _, key := range od.ResultKeys() {
+		result[key] = make([]OutlierDetectResultRecord, 0)
+	}
+	return result
 }
 
 // DetectOutliers detect DataSet values outliers
 func (ds DataSet) DetectOutliers() (output []OutlierDetectOutput) {
+	raw := ds
+
+	if err := ds.ResampleMetrics(); err != nil {
+		log.Printf("Error resample metrics: %s\n", err.Error())
+	}
+	if err := ds.AddDerivedMetrics(); err != nil {
+		log.Printf("Error evaluate derived metrics: %s\n", err.Error())
+	}
 	for _, method := range ds.OutliersDetectionMethod {
-		switch method {
+		outputs, err := ds.DetectByMethod(method)
+
+		if err != nil {
+			log.Printf("Error get detector: %s\n", err.Error())
+			continue
+		}
+		output = append(output, outputs...)
+	}
+	if ds.Ensemble != nil {
+		if out, err := ds.DetectEnsemble(); err == nil {
+			output = append(output, *out)
+		} else {
+			log.Printf("Error ensemble detection: %s\n", err.Error())
+		}
+	}
+	if ds.Gaps != nil {
+		output = append(output, raw.DetectGaps()...)
+	}
+	return
+}
 
-		case ThreeSigmas:
-			for _, m := range ds.Metrics {
-				out, err := ThreeSigmasOutlierDetector(ds, m)
+// DetectGaps detect data gaps of DataSet metrics raw values, metrics attributes gaps are nested into total gaps
+func (ds DataSet) DetectGaps() (output []OutlierDetectOutput) {
+	for _, m := range ds.TotalMetrics() {
+		out, err := GapsOutlierDetector(ds, m)
 
-				if err == nil {
-					output = append(output, *out)
-				}
+		if err != nil {
+			log.Printf("Error gaps detection of %s: %s\n", m.Metric, err.Error())
+			continue
+		}
+		for _, am := range ds.AttributeMetrics(m.Metric) {
+			if attrOut, err := GapsOutlierDetector(ds, am); err == nil {
+				out.AddBreakdown(*attrOut)
 			}
-		default:
-			log.Printf("Unsupported outlier detection method: %s\n", method)
 		}
+		output = append(output, *out)
+	}
+	return
+}
+
+// DetectByMethod detect DataSet values outliers by single method
+func (ds DataSet) DetectByMethod(method string) (output []OutlierDetectOutput, err error) {
+	d, params, err := ds.GetDetector(method)
+
+	if err != nil {
+		return nil, err
+	}
+	totals := ds.TotalMetrics()
+
+	if md, ok := d.(MultiMetricDetector); ok {
+		ds.Metrics = totals
+
+		if out, err := md.DetectMetrics(ds, params); err == nil {
+			output = append(output, *out)
+		}
+		return output, nil
+	}
+	for _, m := range totals {
+		out, err := d.Detect(ds, m, params)
+
+		if err != nil {
+			continue
+		}
+		for _, am := range ds.AttributeMetrics(m.Metric) {
+			if attrOut, err := d.Detect(ds, am, params); err == nil {
+				out.AddBreakdown(*attrOut)
+			}
+		}
+		output = append(output, *out)
+	}
+	return output, nil
+}
+
+// AddBreakdown nest metric attribute outliers into total outliers records of the same direction
+// and overlapping period, attribute outliers without total outliers are added as is
+func (o *OutlierDetectOutput) AddBreakdown(attrOut OutlierDetectOutput) {
+	for level := len(attrOut.levels); level > LevelNone; level-- {
+		for _, rec := range attrOut.Records(level) {
+			if total := o.FindOverlapping(rec); total != nil {
+				total.Breakdown = append(total.Breakdown, rec)
+			} else {
+				o.AddRecord(level, rec)
+			}
+		}
+	}
+}
+
+// FindOverlapping find total record of the same direction with period overlapping given record
+func (o *OutlierDetectOutput) FindOverlapping(rec OutlierDetectResultRecord) *OutlierDetectResultRecord {
+	for level := len(o.levels); level > LevelNone; level-- {
+		recs := o.Records(level)
+
+		for i := range recs {
+			if recs[i].Attribute == "" && recs[i].Direction == rec.Direction && recs[i].Overlaps(rec) {
+				return &recs[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Overlaps check periods overlapping of outliers records
+func (odr OutlierDetectResultRecord) Overlaps(rec OutlierDetectResultRecord) bool {
+	dates, err := ParseDates(
+		odr.OutlierPeriodStart, odr.OutlierPeriodEnd,
+		rec.OutlierPeriodStart, rec.OutlierPeriodEnd,
+	)
+
+	if err != nil {
+		return false
+	}
+	return !dates[0].After(dates[3]) && !dates[2].After(dates[1])
+}
+
+// Label get record metric label with attribute, like Revenue[country=DE]
+func (odr OutlierDetectResultRecord) Label() string {
+	if odr.Attribute == "" {
+		return odr.Metric
+	}
+	return fmt.Sprintf("%s[%s]", odr.Metric, odr.Attribute)
+}
+
+// DetectEnsemble detect DataSet values outliers by ensemble methods, overlapping periods of the same
+// metric, attribute and direction are merged and reported when confirmed by quorum of methods
+func (ds DataSet) DetectEnsemble() (*OutlierDetectOutput, error) {
+	checkStartTime := time.Now().UTC()
+	var outputs []OutlierDetectOutput
+
+	for _, method := range ds.Ensemble.Methods {
+		out, err := ds.DetectByMethod(method)
+
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, out...)
+	}
+	if len(outputs) == 0 {
+		return nil, errors.New("No ensemble methods results")
+	}
+	output := ds.MakeOutlierOutput(Ensemble, time.Time{}, time.Time{})
+	output.DateStart, output.DateEnd = outputs[0].DateStart, outputs[0].DateEnd
+	groups := make(map[string][]EnsembleVote)
+	var keys []string
+
+	for _, out := range outputs {
+		if out.DateStart < output.DateStart {
+			output.DateStart = out.DateStart
+		}
+		if out.DateEnd > output.DateEnd {
+			output.DateEnd = out.DateEnd
+		}
+		for _, vote := range out.Votes() {
+			key := vote.Record.Metric + "\x00" + vote.Record.Attribute + "\x00" + vote.Record.Direction
+
+			if _, ok := groups[key]; !ok {
+				keys = append(keys, key)
+			}
+			groups[key] = append(groups[key], vote)
+		}
+	}
+	for _, key := range keys {
+		for _, rec := range MergeVotes(groups[key], ds.Ensemble.Quorum) {
+			output.AddRecord(rec.Level, rec.Record)
+		}
+	}
+	output.CheckTimeStart = checkStartTime.Format(DateTimeFormat)
+	output.CheckTimeEnd = time.Now().UTC().Format(DateTimeFormat)
+	return output, nil
+}
+
+// Votes get outlier periods votes of output records
+func (o OutlierDetectOutput) Votes() (votes []EnsembleVote) {
+	for level := len(o.levels); level > LevelNone; level-- {
+		for _, rec := range o.Records(level) {
+			dates, err := ParseDates(rec.OutlierPeriodStart, rec.OutlierPeriodEnd)
+
+			if err != nil {
+				continue
+			}
+			votes = append(votes, EnsembleVote{
+				Method: o.OutliersDetectionMethod,
+				Level:  level,
+				Start:  dates[0],
+				End:    dates[1],
+				Record: rec,
+			})
+		}
+	}
+	return
+}
+
+// MergeVotes merge overlapping votes periods, keep periods voted by at least quorum of methods,
+// period level is the highest level confirmed by quorum of methods, period record is the earliest vote record
+// of the highest level, as scores of different methods are in different units
+func MergeVotes(votes []EnsembleVote, quorum int) (merged []EnsembleVote) {
+	sort.SliceStable(votes, func(i, j int) bool {
+		return votes[i].Start.Before(votes[j].Start)
+	})
+
+	for start := 0; start < len(votes); {
+		cluster := votes[start]
+		methodsLevels := make(map[string]int)
+		var metrics []string
+		stop := start
+
+		for ; stop < len(votes) && !votes[stop].Start.After(cluster.End); stop++ {
+			if votes[stop].End.After(cluster.End) {
+				cluster.End = votes[stop].End
+			}
+			if votes[stop].Level > cluster.Level {
+				cluster.Level, cluster.Record = votes[stop].Level, votes[stop].Record
+			}
+			if votes[stop].Level > methodsLevels[votes[stop].Method] {
+				methodsLevels[votes[stop].Method] = votes[stop].Level
+			}
+			metrics = append(metrics, votes[stop].Record.Metrics...)
+		}
+		start = stop
+
+		if len(methodsLevels) < quorum {
+			continue
+		}
+		methods := make([]string, 0, len(methodsLevels))
+
+		for method := range methodsLevels {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		cluster.Level = QuorumLevel(methodsLevels, quorum)
+		cluster.Record.OutlierPeriodStart = cluster.Start.Format(DateTimeFormat)
+		cluster.Record.OutlierPeriodEnd = cluster.End.Format(DateTimeFormat)
+		cluster.Record.Metrics = UniqueStrings(metrics...)
+		cluster.Record.Methods = methods
+		merged = append(merged, cluster)
 	}
 	return
 }
 
+// QuorumLevel get the highest level voted by quorum of methods, methods voting for higher level vote for lower levels too
+func QuorumLevel(methodsLevels map[string]int, quorum int) int {
+	levels := make([]int, 0, len(methodsLevels))
+
+	for _, level := range methodsLevels {
+		levels = append(levels, level)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(levels)))
+
+	if quorum < 1 || quorum > len(levels) {
+		return LevelNone
+	}
+	return levels[quorum-1]
+}
+
+// GetDetector get DataSet detector by method name with resolved params
+func (ds DataSet) GetDetector(method string) (Detector, DetectorParams, error) {
+	d, err := GetDetector(method)
+
+	if err != nil {
+		return nil, nil, err
+	}
+	params, err := ResolveParams(d, ds.MethodsParams[method])
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return d, params, nil
+}
+
+// Validate check DataSet config
+func (ds DataSet) Validate() error {
+	if ds.SiteID == "" {
+		return errors.New("Empty siteId")
+	}
+	if _, _, err := ds.GetTimeAgoAndTimeStepDurations(); err != nil {
+		return err
+	}
+	if _, err := NewDataSource(ds.Source); err != nil {
+		return err
+	}
+	if len(ds.OutliersDetectionMethod) == 0 && ds.Ensemble == nil && ds.Gaps == nil {
+		return errors.New("Empty OutliersDetectionMethod, ensemble and gaps")
+	}
+	if ds.Gaps != nil && (ds.Gaps.BucketsPerStep < 0 || ds.Gaps.MinRatio < 0 || ds.Gaps.MinRatio > 1) {
+		return errors.New("Expected gaps bucketsPerStep >= 0 and 0 <= minRatio <= 1")
+	}
+	for name, definition := range ds.DerivedMetrics {
+		expr, err := ParseExpression(definition)
+
+		if err != nil {
+			return fmt.Errorf("Invalid derived metric %s: %s", name, err)
+		}
+		if len(expr.Vars()) == 0 {
+			return fmt.Errorf("Derived metric %s expression has no metrics", name)
+		}
+		for _, metric := range expr.Vars() {
+			if !ContainsString(ds.MetricesList, metric) {
+				return fmt.Errorf("Derived metric %s uses unknown metric %s, expected one of MetricesList", name, metric)
+			}
+		}
+		if ContainsString(ds.MetricesList, name) {
+			return fmt.Errorf("Derived metric %s duplicates MetricesList metric", name)
+		}
+	}
+	if ds.DerivedBucketsPerStep < 0 {
+		return errors.New("Expected DerivedBucketsPerStep >= 0")
+	}
+	for metric, rc := range ds.Resampling {
+		if !ContainsString(ds.MetricesList, metric) {
+			return fmt.Errorf("Resampling of unknown metric %s, expected one of MetricesList", metric)
+		}
+		if bucket, err := ParseDuration(rc.Bucket); err != nil || bucket <= 0 {
+			return fmt.Errorf("Invalid resampling bucket of metric %s: %s", metric, rc.Bucket)
+		}
+		switch rc.Aggregation {
+		case "", AggregationSum, AggregationMean, AggregationCount, AggregationMin, AggregationMax, AggregationP95:
+		default:
+			return fmt.Errorf("Invalid resampling aggregation of metric %s: %s, expected: sum, mean, count, min, max, p95", metric, rc.Aggregation)
+		}
+		switch rc.Empty {
+		case "", EmptySkip, EmptyZero, EmptyPrevious, EmptyInterpolate:
+		default:
+			return fmt.Errorf("Invalid resampling empty buckets handling of metric %s: %s, expected: skip, zero, previous, interpolate", metric, rc.Empty)
+		}
+	}
+	if ds.DimensionsTopN < 0 {
+		return errors.New("Expected DimensionsTopN >= 0")
+	}
+	if ds.Ensemble != nil {
+		if ds.Ensemble.Quorum < 1 || ds.Ensemble.Quorum > len(ds.Ensemble.Methods) {
+			return errors.New("Ensemble quorum must be in the range from 1 to ensemble methods count")
+		}
+		for _, method := range ds.Ensemble.Methods {
+			if _, _, err := ds.GetDetector(method); err != nil {
+				return err
+			}
+		}
+	}
+	for _, method := range ds.OutliersDetectionMethod {
+		if _, _, err := ds.GetDetector(method); err != nil {
+			return err
+		}
+	}
+	for method := range ds.MethodsParams {
+		if _, err := GetDetector(method); err != nil {
+			return err
+		}
+	}
+	for metric, direction := range ds.Directions {
+		switch direction {
+		case DirectionUp, DirectionDown, DirectionBoth:
+		default:
+			return fmt.Errorf("Invalid direction of metric %s: %s, expected: up, down, both", metric, direction)
+		}
+	}
+	if len(ds.Levels) == 0 && (ds.OutliersMultipler <= 0 || ds.StrongOutliersMultipler < ds.OutliersMultipler) {
+		return errors.New("Expected 0 < OutliersMultipler <= StrongOutliersMultipler")
+	}
+	names := make(map[string]bool)
+
+	for i, level := range ds.Levels {
+		if level.Name == "" || names[level.Name] {
+			return fmt.Errorf("Expected unique non empty severity level names, got: %q", level.Name)
+		}
+		if level.Multipler <= 0 || i > 0 && level.Multipler <= ds.Levels[i-1].Multipler {
+			return fmt.Errorf("Expected positive increasing severity level multipliers, got %s: %g", level.Name, level.Multipler)
+		}
+		names[level.Name] = true
+	}
+	return nil
+}
+
 // SendReport send new outliers detection report
 func (ol OutliersResultLog) SendReport() {
 	// Do stuff
+	if ol.GetType() == LevelGapName {
+		ol.SendGapReport()
+		return
+	}
 	msg := fmt.Sprintf(`
 		Outliers detection result
 		Start date: %s;
@@ -129,14 +1179,51 @@ func (ol OutliersResultLog) SendReport() {
 		Time step: %s;
 		Metric: %s;
 		Attribute: %s;
+		Type: %s;
 		Level: %s;
 		Method: %s;
+		Score: %g;
+		Peak value: %g;
+		Expected value: %g;
+		Threshold: %g;
+		Breakdown: %s;
 	`, ol.OutlierPeriodStart, ol.OutlierPeriodEnd, ol.SiteID, ol.TimeAgo,
-		ol.TimeStep, ol.Metric, ol.Attribute, ol.Level, ol.OutliersDetectionMethod,
+		ol.TimeStep, ol.Metric, ol.Attribute, ol.GetType(), ol.Level, ol.OutliersDetectionMethod,
+		ol.Score, ol.Peak, ol.Expected, ol.Threshold, strings.Join(ol.Breakdown, ", "),
 	)
 	fmt.Println(msg)
 }
 
+// SendGapReport send new data gap report
+func (ol OutliersResultLog) SendGapReport() {
+	msg := fmt.Sprintf(`
+		Data gap detected, metric values stopped arriving or arrive too rarely
+		Start date: %s;
+		End date: %s;
+		Site ID: %s;
+		Time step: %s;
+		Metric: %s;
+		Attribute: %s;
+		Values count per bucket: %g;
+		Usual values count per bucket: %g;
+		Breakdown: %s;
+	`, ol.OutlierPeriodStart, ol.OutlierPeriodEnd, ol.SiteID, ol.TimeStep, ol.Metric, ol.Attribute,
+		ol.Peak, ol.Expected, strings.Join(ol.Breakdown, ", "),
+	)
+	fmt.Println(msg)
+}
+
+// GetType get outlier type by level and direction, gap, drop or spike
+func (ol OutliersResultLog) GetType() string {
+	if ol.Level == LevelGapName {
+		return LevelGapName
+	}
+	if ol.Direction == DirectionDown {
+		return "drop"
+	}
+	return "spike"
+}
+
 // Save save outliers log to file
 func (ol OutliersResultLog) Save() error {
 	body, err := ReadFile(ReportLogFile)
@@ -175,6 +1262,9 @@ func (odr OutlierDetectResultRecord) Equal(orl OutliersResultLog) bool {
 	if odr.Attribute != orl.Attribute {
 		return false
 	}
+	if odr.Direction != orl.Direction && orl.Direction != "" {
+		return false
+	}
 	dates, err := ParseDates(
 		odr.OutlierPeriodStart, odr.OutlierPeriodEnd,
 		orl.OutlierPeriodStart, orl.OutlierPeriodEnd,
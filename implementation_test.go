@@ -0,0 +1,317 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMakeOutlierOutputResultKeys(t *testing.T) {
+	custom := testDataSet("1d", "1h")
+	custom.Levels = []SeverityLevel{{"info", 2}, {"warning", 3}, {"page", 5}}
+
+	tests := []struct {
+		name   string
+		ds     DataSet
+		keys   []string
+		levels []string
+	}{
+		{"default levels", testDataSet("1d", "1h"), []string{"Alarms", "Warnings"}, []string{"warning", "alarm"}},
+		{"custom levels", custom, []string{"info", "page", "warning"}, []string{"info", "warning", "page"}},
+	}
+	for _, tt := range tests {
+		out := tt.ds.MakeOutlierOutput(ThreeSigmas, time.Time{}, time.Time{})
+		var keys, levels []string
+
+		for key := range out.Result {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for level := range tt.levels {
+			out.AddRecord(level+1, OutlierDetectResultRecord{Metric: "Revenue"})
+			levels = append(levels, out.Records(level + 1)[0].Level)
+		}
+		if !reflect.DeepEqual(keys, tt.keys) {
+			t.Errorf("%s: expected result keys %v, got %v", tt.name, tt.keys, keys)
+		}
+		if !reflect.DeepEqual(levels, tt.levels) {
+			t.Errorf("%s: expected records levels %v, got %v", tt.name, tt.levels, levels)
+		}
+	}
+}
+
+func TestResampleDropsFillingBucket(t *testing.T) {
+	mv := testSeries("Revenue", 150, time.Minute, func(i int) float64 { return 1 })
+	resampled := mv.Values.Resample(time.Hour, AggregationSum, EmptySkip)
+	expected := DataSetValues{{testStartDate, 60}, {testStartDate.Add(time.Hour), 60}}
+
+	if !reflect.DeepEqual(resampled, expected) {
+		t.Errorf("Expected complete buckets %v, got %v", expected, resampled)
+	}
+}
+
+func TestAddDerivedMetrics(t *testing.T) {
+	hour := func(h int) time.Time { return testStartDate.Add(time.Duration(h) * time.Hour) }
+	orders := []float64{1, 1, 0, 2, 2}
+	attribute := func(mv MetricValues, attribute string) MetricValues {
+		mv.Attribute = attribute
+		return mv
+	}
+	ds := testDataSet("3h", "1h")
+	ds.DerivedBucketsPerStep = 1
+	ds.DerivedMetrics = map[string]string{"AOV": "Revenue / Orders", "Net": "Revenue - 2 * Refunds"}
+	ds.Metrics = []MetricValues{
+		testSeries("Revenue", 5, time.Hour, func(i int) float64 { return 10 * float64(i+1) }),
+		testSeries("Orders", 5, time.Hour, func(i int) float64 { return orders[i] }),
+		attribute(testSeries("Revenue", 5, time.Hour, func(i int) float64 { return 5 * float64(i+1) }), "country=DE"),
+		attribute(testSeries("Orders", 5, time.Hour, func(i int) float64 { return 1 }), "country=DE"),
+		attribute(testSeries("Revenue", 5, time.Hour, func(i int) float64 { return 1 }), "country=US"),
+	}
+	if attributes := ds.CommonAttributes([]string{"Revenue", "Orders"}); !reflect.DeepEqual(attributes, []string{"", "country=DE"}) {
+		t.Errorf("Expected total and country=DE common attributes, got %v", attributes)
+	}
+	if err := ds.AddDerivedMetrics(); err != nil {
+		t.Fatalf("Error add derived metrics: %s", err)
+	}
+	// window buckets are 01:00 - 03:00, Orders division by zero at 02:00 is skipped,
+	// Net has no Refunds values
+	expected := []MetricValues{
+		{Metric: "AOV", Values: DataSetValues{{hour(1), 20}, {hour(3), 20}}},
+		{Metric: "AOV", Attribute: "country=DE", Values: DataSetValues{{hour(1), 10}, {hour(2), 15}, {hour(3), 20}}},
+	}
+	if !reflect.DeepEqual(ds.Metrics[5:], expected) {
+		t.Errorf("Expected derived metrics %v, got %v", expected, ds.Metrics[5:])
+	}
+	ds.DerivedMetrics = map[string]string{"Invalid": "Revenue +"}
+
+	if err := ds.AddDerivedMetrics(); err == nil {
+		t.Error("Expected error of invalid derived metric expression")
+	}
+}
+
+func TestResample(t *testing.T) {
+	at := func(minutes int) time.Time { return testStartDate.Add(time.Duration(minutes) * time.Minute) }
+	// buckets 00:00 and 03:00 have values, 01:00 and 02:00 are empty, 04:00 is still filling
+	values := DataSetValues{{at(10), 2}, {at(40), 4}, {at(190), 10}, {at(200), 22}, {at(245), 100}}
+	tests := []struct {
+		aggregation string
+		empty       string
+		expected    DataSetValues
+	}{
+		{AggregationSum, EmptySkip, DataSetValues{{at(0), 6}, {at(180), 32}}},
+		{AggregationMean, EmptyZero, DataSetValues{{at(0), 3}, {at(60), 0}, {at(120), 0}, {at(180), 16}}},
+		{AggregationCount, EmptyPrevious, DataSetValues{{at(0), 2}, {at(60), 2}, {at(120), 2}, {at(180), 2}}},
+		{AggregationMax, EmptyInterpolate, DataSetValues{{at(0), 4}, {at(60), 10}, {at(120), 16}, {at(180), 22}}},
+		{AggregationMin, EmptySkip, DataSetValues{{at(0), 2}, {at(180), 10}}},
+	}
+	for _, tt := range tests {
+		if resampled := values.Resample(time.Hour, tt.aggregation, tt.empty); !reflect.DeepEqual(resampled, tt.expected) {
+			t.Errorf("%s %s: expected %v, got %v", tt.aggregation, tt.empty, tt.expected, resampled)
+		}
+	}
+	if resampled := values[:1].Resample(time.Hour, AggregationSum, EmptyZero); resampled != nil {
+		t.Errorf("Expected no complete buckets, got %v", resampled)
+	}
+}
+
+func TestResampleMetrics(t *testing.T) {
+	ds := testDataSet("1d", "1h")
+	ds.Resampling = map[string]ResampleConfig{"Revenue": {Aggregation: AggregationSum, Bucket: "30m"}}
+	revenue := testSeries("Revenue", 90, time.Minute, func(i int) float64 { return 1 })
+	attribute := revenue
+	attribute.Attribute = "country=DE"
+	orders := testSeries("Orders", 90, time.Minute, func(i int) float64 { return 1 })
+	ds.Metrics = []MetricValues{revenue, attribute, orders}
+
+	if err := ds.ResampleMetrics(); err != nil {
+		t.Fatalf("Error resample metrics: %s", err)
+	}
+	expected := DataSetValues{{testStartDate, 30}, {testStartDate.Add(30 * time.Minute), 30}}
+
+	for _, mv := range ds.Metrics[:2] {
+		if !reflect.DeepEqual(mv.Values, expected) {
+			t.Errorf("Expected resampled %s %s values %v, got %v", mv.Metric, mv.Attribute, expected, mv.Values)
+		}
+	}
+	if !reflect.DeepEqual(ds.Metrics[2], orders) {
+		t.Errorf("Expected Orders values without resampling kept")
+	}
+	ds.Resampling["Orders"] = ResampleConfig{Bucket: "1x"}
+
+	if err := ds.ResampleMetrics(); err == nil {
+		t.Error("Expected error of invalid resampling bucket")
+	}
+}
+
+func TestMergeVotes(t *testing.T) {
+	at := func(minutes int) time.Time { return testStartDate.Add(time.Duration(minutes) * time.Minute) }
+	vote := func(method string, level, start, end int) EnsembleVote {
+		return EnsembleVote{Method: method, Level: level, Start: at(start), End: at(end), Record: OutlierDetectResultRecord{
+			Metric: "Revenue", Metrics: []string{method}, Peak: float64(start),
+		}}
+	}
+	type period struct {
+		start, end, level int
+		methods           []string
+		peak              float64
+	}
+	tests := []struct {
+		name     string
+		votes    []EnsembleVote
+		quorum   int
+		expected []period
+	}{
+		{"overlapping", []EnsembleVote{vote(IQR, 2, 30, 120), vote(MAD, 1, 0, 60)}, 2,
+			[]period{{0, 120, 1, []string{IQR, MAD}, 30}}},
+		{"disjoint", []EnsembleVote{vote(MAD, 2, 0, 60), vote(IQR, 2, 90, 120)}, 2, nil},
+		{"disjoint single method quorum", []EnsembleVote{vote(MAD, 1, 0, 60), vote(IQR, 2, 90, 120)}, 1,
+			[]period{{0, 60, 1, []string{MAD}, 0}, {90, 120, 2, []string{IQR}, 90}}},
+		{"method voting twice", []EnsembleVote{vote(MAD, 2, 0, 60), vote(MAD, 2, 30, 90)}, 2, nil},
+		{"chained overlaps", []EnsembleVote{vote(MAD, 1, 0, 60), vote(IQR, 1, 50, 100), vote(EWMA, 1, 90, 150)}, 3,
+			[]period{{0, 150, 1, []string{EWMA, IQR, MAD}, 0}}},
+		{"quorum level", []EnsembleVote{vote(MAD, 2, 0, 60), vote(IQR, 2, 10, 60), vote(EWMA, 1, 20, 60)}, 2,
+			[]period{{0, 60, 2, []string{EWMA, IQR, MAD}, 0}}},
+		{"quorum of lower level", []EnsembleVote{vote(MAD, 2, 0, 60), vote(IQR, 2, 10, 60), vote(EWMA, 1, 20, 60)}, 3,
+			[]period{{0, 60, 1, []string{EWMA, IQR, MAD}, 0}}},
+	}
+	for _, tt := range tests {
+		merged := MergeVotes(tt.votes, tt.quorum)
+
+		if len(merged) != len(tt.expected) {
+			t.Errorf("%s: expected %d periods, got %+v", tt.name, len(tt.expected), merged)
+			continue
+		}
+		for i, p := range tt.expected {
+			rec := merged[i].Record
+
+			if rec.OutlierPeriodStart != at(p.start).Format(DateTimeFormat) || rec.OutlierPeriodEnd != at(p.end).Format(DateTimeFormat) ||
+				merged[i].Level != p.level || !reflect.DeepEqual(rec.Methods, p.methods) || rec.Peak != p.peak {
+				t.Errorf("%s: expected period %+v, got level %d %+v", tt.name, p, merged[i].Level, rec)
+			}
+			metrics := append([]string(nil), rec.Metrics...)
+			sort.Strings(metrics)
+
+			if !reflect.DeepEqual(metrics, p.methods) {
+				t.Errorf("%s: expected metrics of all votes, got %v", tt.name, rec.Metrics)
+			}
+		}
+	}
+}
+
+func TestQuorumLevel(t *testing.T) {
+	levels := map[string]int{MAD: 3, IQR: 1, EWMA: 2}
+
+	for quorum, expected := range []int{LevelNone, 3, 2, 1, LevelNone} {
+		if level := QuorumLevel(levels, quorum); level != expected {
+			t.Errorf("Quorum %d: expected level %d, got %d", quorum, expected, level)
+		}
+	}
+}
+
+func TestDetectEnsemble(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	n := 2 * 24 * 60
+	spike := testStartDate.Add(time.Duration(n-10*60) * time.Minute)
+	ds := testDataSet("1d", "1h")
+	ds.Ensemble = &EnsembleConfig{Methods: []string{ThreeSigmas, MAD, IQR}, Quorum: 2}
+	ds.Metrics = []MetricValues{testSeries("Revenue", n, time.Minute, func(i int) float64 {
+		if i >= n-10*60 && i < n-10*60+3 {
+			return 150
+		}
+		return 100 + 2*rnd.NormFloat64()
+	})}
+	out, err := ds.DetectEnsemble()
+
+	if err != nil {
+		t.Fatalf("Error detect: %s", err)
+	}
+	alarms := out.Records(2)
+
+	if len(alarms) != 1 || alarms[0].OutlierPeriodStart > spike.Format(DateTimeFormat) ||
+		alarms[0].OutlierPeriodEnd <= spike.Format(DateTimeFormat) ||
+		!reflect.DeepEqual(alarms[0].Methods, []string{ThreeSigmas, IQR, MAD}) {
+		t.Errorf("Expected alarm of spike at %s by all methods, got %+v", spike, alarms)
+	}
+	for level, recs := range out.Result {
+		for _, rec := range recs {
+			if len(rec.Methods) < 2 {
+				t.Errorf("Expected %s records confirmed by quorum, got %+v", level, rec)
+			}
+		}
+	}
+}
+
+func TestAttributeMetrics(t *testing.T) {
+	attribute := func(metric, attribute string, value float64) MetricValues {
+		mv := testSeries(metric, 10, time.Hour, func(i int) float64 { return value })
+		mv.Attribute = attribute
+		return mv
+	}
+	ds := testDataSet("1d", "1h")
+	ds.Dimensions = map[string][]string{"country": {"DE", "US", "FR"}, "device": {"mobile"}}
+	ds.Metrics = []MetricValues{
+		attribute("Revenue", "", 100),
+		attribute("Revenue", "country=FR", 1),
+		attribute("Revenue", "country=DE", 3),
+		attribute("Revenue", "device=mobile", 2),
+		attribute("Revenue", "browser=chrome", 9),
+		attribute("Revenue", "country=US", 5),
+		attribute("Orders", "country=DE", 7),
+	}
+	labels := func(metrics []MetricValues) (attributes []string) {
+		for _, mv := range metrics {
+			attributes = append(attributes, mv.Attribute)
+		}
+		return
+	}
+	if attributes := labels(ds.AttributeMetrics("Revenue")); !reflect.DeepEqual(attributes, []string{"country=US", "country=DE", "country=FR", "device=mobile"}) {
+		t.Errorf("Expected Revenue attributes of dimensions by volume, got %v", attributes)
+	}
+	ds.DimensionsTopN = 2
+
+	if attributes := labels(ds.AttributeMetrics("Revenue")); !reflect.DeepEqual(attributes, []string{"country=US", "country=DE", "device=mobile"}) {
+		t.Errorf("Expected top 2 Revenue attributes of every dimension, got %v", attributes)
+	}
+}
+
+func TestAddBreakdown(t *testing.T) {
+	record := func(attribute, direction, start, end string) OutlierDetectResultRecord {
+		return OutlierDetectResultRecord{
+			Metric:             "Revenue",
+			Attribute:          attribute,
+			Direction:          direction,
+			OutlierPeriodStart: "2021-01-04 " + start + ":00",
+			OutlierPeriodEnd:   "2021-01-04 " + end + ":00",
+		}
+	}
+	ds := testDataSet("1d", "1h")
+	total := ds.MakeOutlierOutput(MAD, time.Time{}, time.Time{})
+	total.AddRecord(2, record("", DirectionUp, "10:00", "11:00"))
+	total.AddRecord(1, record("", DirectionDown, "13:00", "14:00"))
+
+	attributes := ds.MakeOutlierOutput(MAD, time.Time{}, time.Time{})
+	attributes.AddRecord(2, record("country=DE", DirectionUp, "10:30", "10:40"))
+	attributes.AddRecord(1, record("country=US", DirectionUp, "10:50", "11:10"))
+	attributes.AddRecord(1, record("country=DE", DirectionDown, "16:00", "17:00"))
+	attributes.AddRecord(2, record("country=FR", DirectionUp, "13:00", "14:00"))
+	total.AddBreakdown(*attributes)
+
+	alarms, warnings := total.Records(2), total.Records(1)
+
+	if len(alarms) != 2 || len(alarms[0].Breakdown) != 2 || alarms[0].Breakdown[0].Attribute != "country=DE" ||
+		alarms[0].Breakdown[1].Attribute != "country=US" {
+		t.Fatalf("Expected overlapping up attributes nested into total alarm, got %+v", alarms)
+	}
+	if alarms[1].Attribute != "country=FR" || len(warnings) != 2 || len(warnings[0].Breakdown) != 0 || warnings[1].Attribute != "country=DE" {
+		t.Errorf("Expected other attributes outliers at top level, got alarms %+v, warnings %+v", alarms, warnings)
+	}
+	if total.FindOverlapping(record("country=DE", DirectionUp, "11:00", "12:00")) != &alarms[0] {
+		t.Error("Expected total alarm overlapping at period end")
+	}
+	if total.FindOverlapping(record("country=DE", DirectionUp, "11:01", "12:00")) != nil {
+		t.Error("Expected no total record overlapping after period end")
+	}
+}
@@ -1,11 +1,25 @@
 package main
 
-import "flag"
+import (
+	"flag"
+	"log"
+)
 
-var serverPort = flag.Uint("-p", 8080, "Server port")
+var serverPort = flag.Uint("p", 8080, "Server port")
 var ch = make(chan OutlierDetectOutput)
 
 func main() {
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		if err := RunCommand(flag.Args()); err != nil {
+			log.Fatalf("Error %s: %s\n", flag.Arg(0), err.Error())
+		}
+		return
+	}
+	if err := CheckDataSets(); err != nil {
+		log.Fatalf("Error load datasets: %s\n", err.Error())
+	}
 	go OutliersReporter(ch)
 	go DataSetsChecker(ch)
 	StartServer(*serverPort)
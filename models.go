@@ -17,6 +17,14 @@ type DataSetValues []DataSetValue
 type OutliersDetection struct {
 	OutliersMultipler       float64 `json:"OutliersMultipler"`
 	StrongOutliersMultipler float64 `json:"StrongOutliersMultipler"`
+	// Levels severity levels ordered by multipler, replace warning and alarm multipliers when set
+	Levels []SeverityLevel `json:"Levels,omitempty"`
+}
+
+// SeverityLevel named outliers level with its multipler
+type SeverityLevel struct {
+	Name      string  `json:"Name"`
+	Multipler float64 `json:"Multipler"`
 }
 
 // DataSetValue value for dataset
@@ -32,31 +40,82 @@ type MetricValues struct {
 	Values    DataSetValues `json:"values"`
 }
 
+// SourceConfig DataSet values source, Type is push (default), synthetic, prometheus, http or sql,
+// decoded from object or type string
+type SourceConfig struct {
+	Type string `json:"type"`
+	// URL http sources base url
+	URL string `json:"url"`
+	// Headers http sources request headers, like Authorization
+	Headers map[string]string `json:"headers"`
+	// Queries metrics queries by metric name, metric name by default, required for sql source
+	Queries map[string]string `json:"queries"`
+	// Step prometheus query resolution, TimeStep/24 by default
+	Step string `json:"step"`
+	// AttributeLabel prometheus series label used as metric attribute
+	AttributeLabel string `json:"attributeLabel"`
+	// Driver sql source database/sql driver name, like postgres or sqlite3
+	Driver string `json:"driver"`
+	// DSN sql source data source name
+	DSN string `json:"dsn"`
+	// TimeFormat sql source time format of window args and string time columns, Go time layout or unix,
+	// window args are time values by default
+	TimeFormat string `json:"timeFormat"`
+}
+
+// IngestedValue single metric value pushed to DataSet values store
+type IngestedValue struct {
+	Metric    string  `json:"metric"`
+	Attribute string  `json:"attribute"`
+	Date      string  `json:"date"`
+	Value     float64 `json:"value"`
+}
+
 // DataSet icoming data
 type DataSet struct {
-	SiteID                  string   `json:"siteId"`
-	TimeAgo                 string   `json:"TimeAgo"`
-	TimeStep                string   `json:"TimeStep"`
-	OutliersDetectionMethod []string `json:"OutliersDetectionMethod"`
-	MetricesList            []string `json:"MetricesList"`
-	MinVisitorsPerTimeStep  int      `json:"MinVisitorsPerTimeStep"`
+	SiteID                  string       `json:"siteId"`
+	TimeAgo                 string       `json:"TimeAgo"`
+	TimeStep                string       `json:"TimeStep"`
+	OutliersDetectionMethod []string     `json:"OutliersDetectionMethod"`
+	MetricesList            []string     `json:"MetricesList"`
+	MinVisitorsPerTimeStep  int          `json:"MinVisitorsPerTimeStep"`
+	Source                  SourceConfig `json:"source"`
 	OutliersDetection       `json:"OutliersDetection"`
-	Metrics                 []MetricValues `json:"Values"`
+	MethodsParams           map[string]DetectorParams `json:"MethodsParams"`
+	Directions              map[string]string         `json:"Directions"`
+	Ensemble                *EnsembleConfig           `json:"ensemble,omitempty"`
+	Gaps                    *GapsConfig               `json:"gaps,omitempty"`
+	Dimensions              map[string][]string       `json:"Dimensions"`
+	DimensionsTopN          int                       `json:"DimensionsTopN"`
+	DerivedMetrics          map[string]string         `json:"DerivedMetrics"`
+	DerivedBucketsPerStep   int                       `json:"DerivedBucketsPerStep"`
+	Resampling              map[string]ResampleConfig `json:"Resampling"`
+	Metrics                 []MetricValues            `json:"Values"`
 }
 
 // OutlierDetectResultRecord struct for outliers warnings and alarms detects
 type OutlierDetectResultRecord struct {
-	OutlierPeriodStart string `json:"OutlierPeriodStart"`
-	OutlierPeriodEnd   string `json:"OutlierPeriodEnd"`
-	Metric             string `json:"Metric"`
-	Attribute          string `json:"Attribute"`
+	OutlierPeriodStart string   `json:"OutlierPeriodStart"`
+	OutlierPeriodEnd   string   `json:"OutlierPeriodEnd"`
+	Metric             string   `json:"Metric"`
+	Attribute          string   `json:"Attribute"`
+	Direction          string   `json:"Direction"`
+	Metrics            []string `json:"Metrics,omitempty"`
+	Methods            []string `json:"Methods,omitempty"`
+	Level              string   `json:"Level,omitempty"`
+	// Score anomaly score in detector units, higher is more anomalous, not comparable across methods
+	Score    float64 `json:"Score"`
+	Peak     float64 `json:"Peak"`
+	Expected float64 `json:"Expected"`
+	// Threshold crossed threshold of record level in values units or in score units, depending on method
+	Threshold float64 `json:"Threshold"`
+	// Breakdown outliers of metric attributes within record period
+	Breakdown []OutlierDetectResultRecord `json:"Breakdown,omitempty"`
 }
 
-// OutliersDetectResult container for outliers warnings and alarms detects
-type OutliersDetectResult struct {
-	Warnings []OutlierDetectResultRecord `json:"Warnings"`
-	Alarms   []OutlierDetectResultRecord `json:"Alarms"`
-}
+// OutliersDetectResult container for outliers detects by severity level result key,
+// Warnings and Alarms for default levels and level name for custom levels
+type OutliersDetectResult map[string][]OutlierDetectResultRecord
 
 // OutlierDetectOutput output for DataSet outliers detection
 type OutlierDetectOutput struct {
@@ -69,17 +128,90 @@ type OutlierDetectOutput struct {
 	DateStart               string               `json:"DateStart"`
 	DateEnd                 string               `json:"DateEnd"`
 	Result                  OutliersDetectResult `json:"Result"`
+	levels                  []string
+	keys                    []string
 }
 
 // OutliersResultLog outliers results logging
 type OutliersResultLog struct {
-	SiteID                  string `json:"siteId"`
-	OutliersDetectionMethod string `json:"OutliersDetectionMethod"`
-	TimeAgo                 string `json:"TimeAgo"`
-	TimeStep                string `json:"TimeStep"`
-	OutlierPeriodStart      string `json:"OutlierPeriodStart"`
-	OutlierPeriodEnd        string `json:"OutlierPeriodEnd"`
-	Metric                  string `json:"Metric"`
-	Attribute               string `json:"Attribute"`
-	Level                   string `json:"Level"`
+	SiteID                  string   `json:"siteId"`
+	OutliersDetectionMethod string   `json:"OutliersDetectionMethod"`
+	TimeAgo                 string   `json:"TimeAgo"`
+	TimeStep                string   `json:"TimeStep"`
+	OutlierPeriodStart      string   `json:"OutlierPeriodStart"`
+	OutlierPeriodEnd        string   `json:"OutlierPeriodEnd"`
+	Metric                  string   `json:"Metric"`
+	Attribute               string   `json:"Attribute"`
+	Direction               string   `json:"Direction"`
+	Level                   string   `json:"Level"`
+	Score                   float64  `json:"Score"`
+	Peak                    float64  `json:"Peak"`
+	Expected                float64  `json:"Expected"`
+	Threshold               float64  `json:"Threshold"`
+	Breakdown               []string `json:"Breakdown,omitempty"`
+}
+
+// DetectionWindow metric values within DataSet TimeAgo window
+type DetectionWindow struct {
+	StartDate time.Time
+	EndDate   time.Time
+	TimeAgo   time.Duration
+	TimeStep  time.Duration
+	Values    DataSetValues
+}
+
+// OutlierPoint single value outlier level and direction
+type OutlierPoint struct {
+	Level     int
+	Direction string
+	Metrics   []string
+	Score     float64
+	Value     float64
+	Expected  float64
+	Threshold float64
+}
+
+// AlignedMetrics DataSet metrics values aligned onto common time buckets
+type AlignedMetrics struct {
+	Window  *DetectionWindow
+	Metrics []string
+	Dates   []time.Time
+	Rows    [][]float64
+}
+
+// EnsembleConfig ensemble detection methods, outliers are reported when confirmed by quorum of methods
+type EnsembleConfig struct {
+	Methods []string `json:"methods"`
+	Quorum  int      `json:"quorum"`
+}
+
+// ResampleConfig metric resampling into regular buckets, Aggregation is sum, mean (default), count, min, max or p95,
+// Empty is skip (default), zero, previous or interpolate
+type ResampleConfig struct {
+	Aggregation string `json:"aggregation"`
+	Bucket      string `json:"bucket"`
+	Empty       string `json:"empty"`
+}
+
+// GapsConfig data gaps detection, buckets with values count below MinRatio of usual count are gaps
+type GapsConfig struct {
+	BucketsPerStep int     `json:"bucketsPerStep"`
+	MinRatio       float64 `json:"minRatio"`
+}
+
+// EnsembleVote single method outlier period vote
+type EnsembleVote struct {
+	Method string
+	Level  int
+	Start  time.Time
+	End    time.Time
+	Record OutlierDetectResultRecord
+}
+
+// ESDCandidate generalized ESD test outlier candidate
+type ESDCandidate struct {
+	Index     int
+	Statistic float64
+	// Critical test critical values for every significance level
+	Critical []float64
 }
@@ -1,31 +1,85 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"os"
 	"strconv"
+	"sync"
 	"time"
 )
 
+// valuesStoreMu serializes DataSets values store writes, valuesCompacted last compaction time by siteId
+var (
+	valuesStoreMu   sync.Mutex
+	valuesCompacted = make(map[string]time.Time)
+)
+
 // GetDataSetBySiteID get single DataSet by siteID
 func GetDataSetBySiteID(siteID string) (*DataSet, error) {
-	sets, err := GetDataSets()
+	sets, err := ReadDataSets()
 
 	if err != nil {
 		return nil, err
 	}
 	for _, ds := range sets {
 		if ds.SiteID == siteID {
+			if err = ds.Validate(); err != nil {
+				return nil, fmt.Errorf("Invalid DataSet %s config: %s", ds.SiteID, err)
+			}
 			return &ds, nil
 		}
 	}
 	return nil, errors.New("DataSet not found")
 }
 
-// GetDataSets get DataSets from store
+// GetDataSets get valid DataSets from store, invalid DataSets are skipped and logged
 func GetDataSets() ([]DataSet, error) {
+	sets, err := ReadDataSets()
+
+	if err != nil {
+		return nil, err
+	}
+	return ValidDataSets(sets), nil
+}
+
+// CheckDataSets check every DataSet of store is valid
+func CheckDataSets() error {
+	sets, err := ReadDataSets()
+
+	if err != nil {
+		return err
+	}
+	for _, ds := range sets {
+		if err = ds.Validate(); err != nil {
+			return fmt.Errorf("Invalid DataSet %s config: %s", ds.SiteID, err)
+		}
+	}
+	return nil
+}
+
+// ValidDataSets filter valid DataSets, invalid DataSets are logged
+func ValidDataSets(sets []DataSet) []DataSet {
+	valid := make([]DataSet, 0, len(sets))
+
+	for _, ds := range sets {
+		if err := ds.Validate(); err != nil {
+			log.Printf("Skip invalid DataSet %s config: %s\n", ds.SiteID, err.Error())
+			continue
+		}
+		valid = append(valid, ds)
+	}
+	return valid
+}
+
+// ReadDataSets read DataSets from store without validation
+func ReadDataSets() ([]DataSet, error) {
 	body, err := ReadFile(ConfigFile)
 
 	if err != nil {
@@ -38,12 +92,199 @@ func GetDataSets() ([]DataSet, error) {
 	if err != nil {
 		return nil, fmt.Errorf("Error decode config file: %s", err)
 	}
-	if ds, ok := dest["Datasets"]; ok {
-		return ds, nil
+	if sets, ok := dest["Datasets"]; ok {
+		return sets, nil
 	}
 	return nil, errors.New("Cannot found 'Datasets' key in config file root")
 }
 
+// DecodeIngestedValues decode JSON array or NDJSON of ingested values
+func DecodeIngestedValues(body []byte) (values []IngestedValue, err error) {
+	body = bytes.TrimSpace(body)
+
+	if len(body) > 0 && body[0] == '[' {
+		if err = json.Unmarshal(body, &values); err != nil {
+			return nil, fmt.Errorf("Error decode values array: %s", err)
+		}
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+
+	for {
+		var v IngestedValue
+
+		if err = decoder.Decode(&v); err == io.EOF {
+			return values, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("Error decode values line %d: %s", len(values)+1, err)
+		}
+		values = append(values, v)
+	}
+}
+
+// ParseValueDate parse ingested value date in DateTimeFormat or RFC 3339 format
+func ParseValueDate(date string) (time.Time, error) {
+	if t, err := time.Parse(DateTimeFormat, date); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, date)
+
+	if err != nil {
+		return t, fmt.Errorf("Invalid date %q, expected: %s or RFC 3339", date, DateTimeFormat)
+	}
+	return t.UTC(), nil
+}
+
+// MetricsIngestedValues convert metrics values to ingested values
+func MetricsIngestedValues(metrics []MetricValues) (values []IngestedValue) {
+	for _, mv := range metrics {
+		for _, v := range mv.Values {
+			values = append(values, IngestedValue{mv.Metric, mv.Attribute, v.Date.Format(DateTimeFormat), v.Value})
+		}
+	}
+	return
+}
+
+// EncodeIngestedValues check ingested values of DataSet metrics and encode them as values store lines
+func EncodeIngestedValues(ds DataSet, values []IngestedValue) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+
+	for i, v := range values {
+		if !ContainsString(ds.MetricesList, v.Metric) {
+			return nil, fmt.Errorf("Value %d: unknown metric %q, expected one of MetricesList", i+1, v.Metric)
+		}
+		date, err := ParseValueDate(v.Date)
+
+		if err != nil {
+			return nil, fmt.Errorf("Value %d: %s", i+1, err)
+		}
+		v.Date = date.Format(DateTimeFormat)
+
+		if err = encoder.Encode(v); err != nil {
+			return nil, fmt.Errorf("Value %d: error encode: %s", i+1, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// SaveIngestedValues append encoded values lines to DataSet values store, values older than DataSet values
+// retention are dropped from store at most once per ValuesCompactInterval
+func SaveIngestedValues(ds DataSet, lines []byte) error {
+	retention, err := ds.ValuesRetention()
+
+	if err != nil {
+		return err
+	}
+	valuesStoreMu.Lock()
+	defer valuesStoreMu.Unlock()
+
+	if err := os.MkdirAll(ValuesDir, 0755); err != nil {
+		return fmt.Errorf("Error create values store: %s", err)
+	}
+	path := ValuesDir + ds.SiteID + ".ndjson"
+	now := time.Now().UTC()
+
+	if now.Sub(valuesCompacted[ds.SiteID]) >= ValuesCompactInterval {
+		if err = CompactIngestedValues(path, now.Add(-retention), lines); err != nil {
+			return err
+		}
+		valuesCompacted[ds.SiteID] = now
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return fmt.Errorf("Error open values store: %s", err)
+	}
+	defer file.Close()
+
+	if _, err = file.Write(lines); err != nil {
+		return fmt.Errorf("Error write values store: %s", err)
+	}
+	return nil
+}
+
+// CompactIngestedValues rewrite values store file without values dated before since and with appended lines
+func CompactIngestedValues(path string, since time.Time, lines []byte) error {
+	var buf bytes.Buffer
+	file, err := os.Open(path)
+
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Error open values store: %s", err)
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(file)
+
+		for scanner.Scan() {
+			var v IngestedValue
+
+			if json.Unmarshal(scanner.Bytes(), &v) == nil {
+				if date, err := ParseValueDate(v.Date); err == nil && date.Before(since) {
+					continue
+				}
+			}
+			buf.Write(scanner.Bytes())
+			buf.WriteByte('\n')
+		}
+		file.Close()
+
+		if err = scanner.Err(); err != nil {
+			return fmt.Errorf("Error read values store: %s", err)
+		}
+	}
+	buf.Write(lines)
+
+	if err = ioutil.WriteFile(path+".tmp", buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Error write values store: %s", err)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("Error replace values store: %s", err)
+	}
+	return nil
+}
+
+// LoadIngestedValues load DataSet values store values dated since given date grouped by metric and attribute
+// and sorted by date
+func LoadIngestedValues(siteID string, since time.Time) (metrics []MetricValues, err error) {
+	valuesStoreMu.Lock()
+	defer valuesStoreMu.Unlock()
+
+	file, err := os.Open(ValuesDir + siteID + ".ndjson")
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error open values store: %s", err)
+	}
+	defer file.Close()
+
+	index := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		var v IngestedValue
+
+		if err = json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			return nil, fmt.Errorf("Error decode values store: %s", err)
+		}
+		date, err := ParseValueDate(v.Date)
+
+		if err != nil {
+			return nil, fmt.Errorf("Error decode values store: %s", err)
+		}
+		if date.Before(since) {
+			continue
+		}
+		metrics = AddMetricValue(metrics, index, v.Metric, v.Attribute, DataSetValue{date, v.Value})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Error read values store: %s", err)
+	}
+	SortMetricsValues(metrics)
+	return metrics, nil
+}
+
 // ParseDuration parse time duration from string, like 1d, 24h
 func ParseDuration(stringDuration string) (duration time.Duration, err error) {
 	l := len(stringDuration)
@@ -121,15 +362,10 @@ func LogOutliersReports(o OutlierDetectOutput) {
 		return
 	}
 
-	levels := map[string][]OutlierDetectResultRecord{
-		"alarm":   o.Result.Alarms,
-		"warning": o.Result.Warnings,
-	}
-
-	for lvl, recs := range levels {
-		for _, rec := range recs {
+	for level := len(o.levels); level > LevelNone; level-- {
+		for _, rec := range o.Records(level) {
 			if !CheckLogExists(logs, rec) {
-				WriteAndReportOutlierLog(o, rec, lvl)
+				WriteAndReportOutlierLog(o, rec, rec.Level)
 			}
 		}
 	}
@@ -146,7 +382,15 @@ func WriteAndReportOutlierLog(o OutlierDetectOutput, r OutlierDetectResultRecord
 		OutlierPeriodEnd:        r.OutlierPeriodEnd,
 		Metric:                  r.Metric,
 		Attribute:               r.Attribute,
+		Direction:               r.Direction,
 		Level:                   level,
+		Score:                   r.Score,
+		Peak:                    r.Peak,
+		Expected:                r.Expected,
+		Threshold:               r.Threshold,
+	}
+	for _, b := range r.Breakdown {
+		l.Breakdown = append(l.Breakdown, fmt.Sprintf("%s %s (%s)", b.Label(), b.Level, b.OutlierPeriodStart))
 	}
 	if err := l.Save(); err != nil {
 		log.Printf("Error save outliers log: %s\n", err.Error())
@@ -164,8 +408,10 @@ func DataSetsChecker(c chan OutlierDetectOutput) {
 
 		if err == nil {
 			for _, ds := range datasets {
-				ds.GenerateData()
-
+				if err = ds.LoadData(); err != nil {
+					log.Printf("Error load DataSet %s values: %s\n", ds.SiteID, err.Error())
+					continue
+				}
 				for _, o := range ds.DetectOutliers() {
 					c <- o
 				}
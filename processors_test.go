@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValuesRetention(t *testing.T) {
+	ds := testDataSet("1d", "1h")
+	tests := []struct {
+		name      string
+		methods   []string
+		ensemble  []string
+		retention time.Duration
+	}{
+		{"window", []string{ThreeSigmas}, nil, 25 * time.Hour},
+		{"period over period history", []string{ThreeSigmas, PeriodOverPeriod}, nil, 25*time.Hour + 168*time.Hour},
+		{"ensemble history", []string{ThreeSigmas}, []string{MAD, PeriodOverPeriod}, 25*time.Hour + 168*time.Hour},
+	}
+	for _, tt := range tests {
+		ds.OutliersDetectionMethod, ds.Ensemble = tt.methods, nil
+
+		if tt.ensemble != nil {
+			ds.Ensemble = &EnsembleConfig{Methods: tt.ensemble, Quorum: 1}
+		}
+		retention, err := ds.ValuesRetention()
+
+		if err != nil || retention != tt.retention {
+			t.Errorf("%s: expected retention %s, got %s (%v)", tt.name, tt.retention, retention, err)
+		}
+	}
+}
+
+func TestSaveIngestedValuesCompaction(t *testing.T) {
+	ds := testStoreDataSet(t, "values-compaction-test")
+	now := time.Now().UTC()
+	old := now.Add(-48 * time.Hour).Format(DateTimeFormat)
+	recent := now.Add(-2 * time.Hour).Format(DateTimeFormat)
+
+	for i, date := range []string{old, recent} {
+		lines, err := EncodeIngestedValues(ds, []IngestedValue{{Metric: "Revenue", Date: date, Value: float64(i)}})
+
+		if err != nil {
+			t.Fatalf("Error encode values: %s", err)
+		}
+		// values written after compaction are appended as is
+		valuesCompacted[ds.SiteID] = now
+
+		if err = SaveIngestedValues(ds, lines); err != nil {
+			t.Fatalf("Error save values: %s", err)
+		}
+	}
+	delete(valuesCompacted, ds.SiteID)
+	lines, _ := EncodeIngestedValues(ds, []IngestedValue{{Metric: "Orders", Date: now.Format(DateTimeFormat), Value: 2}})
+
+	if err := SaveIngestedValues(ds, lines); err != nil {
+		t.Fatalf("Error save values: %s", err)
+	}
+	body, err := ioutil.ReadFile(ValuesDir + ds.SiteID + ".ndjson")
+
+	if err != nil {
+		t.Fatalf("Error read values store: %s", err)
+	}
+	stored := string(body)
+
+	if strings.Contains(stored, old) || !strings.Contains(stored, recent) || !strings.Contains(stored, `"Orders"`) {
+		t.Errorf("Expected values older than retention dropped and others kept, got:\n%s", stored)
+	}
+	if strings.Count(stored, "\n") != 2 {
+		t.Errorf("Expected 2 stored values, got:\n%s", stored)
+	}
+	metrics, err := LoadIngestedValues(ds.SiteID, now.Add(-time.Hour))
+
+	if err != nil || len(metrics) != 1 || metrics[0].Metric != "Orders" {
+		t.Errorf("Expected values since date only, got %v (%v)", metrics, err)
+	}
+}
+
+func TestValidDataSets(t *testing.T) {
+	valid := testDataSet("1d", "1h")
+	valid.OutliersDetectionMethod = []string{ThreeSigmas}
+	invalid := valid
+	invalid.SiteID = "sql"
+	invalid.Source = SourceConfig{Type: SourceSQL, Driver: "missing", DSN: "test"}
+	sets := ValidDataSets([]DataSet{invalid, valid})
+
+	if len(sets) != 1 || sets[0].SiteID != valid.SiteID {
+		t.Errorf("Expected only valid DataSet %s, got %v", valid.SiteID, sets)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DetectorParam detector parameter schema
+type DetectorParam struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Default     float64 `json:"default"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+}
+
+// DetectorParams detector parameters values by name
+type DetectorParams map[string]float64
+
+// Detector outliers detection method
+type Detector interface {
+	// Name method name used in DataSet OutliersDetectionMethod
+	Name() string
+	// Params method specific parameters schema
+	Params() []DetectorParam
+	// Detect detect outliers in single metric values
+	Detect(ds DataSet, mv MetricValues, params DetectorParams) (*OutlierDetectOutput, error)
+}
+
+// MultiMetricDetector detector over all DataSet metrics together
+type MultiMetricDetector interface {
+	DetectMetrics(ds DataSet, params DetectorParams) (*OutlierDetectOutput, error)
+}
+
+// Forecaster detector which can return expected metric values
+type Forecaster interface {
+	Forecast(ds DataSet, mv MetricValues, params DetectorParams) (DataSetValues, error)
+}
+
+// HistoryDetector detector using metric values older than TimeAgo window
+type HistoryDetector interface {
+	// History age of used values before TimeAgo window
+	History(params DetectorParams) time.Duration
+}
+
+// ParamsChecker detector with constraints between its params, like warning and alarm thresholds order
+type ParamsChecker interface {
+	CheckParams(params DetectorParams) error
+}
+
+var detectors = make(map[string]Detector)
+
+// RegisterDetector add detector to registry, panics on duplicate names
+func RegisterDetector(d Detector) {
+	if _, ok := detectors[d.Name()]; ok {
+		panic(fmt.Sprintf("Detector already registered: %s", d.Name()))
+	}
+	detectors[d.Name()] = d
+}
+
+// GetDetector get registered detector by method name
+func GetDetector(name string) (Detector, error) {
+	if d, ok := detectors[name]; ok {
+		return d, nil
+	}
+	return nil, fmt.Errorf(
+		"Unsupported outlier detection method: %s, expected: %s",
+		name, strings.Join(DetectorsNames(), ", "),
+	)
+}
+
+// DetectorsNames get sorted names of registered detectors
+func DetectorsNames() []string {
+	names := make([]string, 0, len(detectors))
+
+	for name := range detectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveParams merge given params with schema defaults and check bounds
+func ResolveParams(d Detector, given DetectorParams) (DetectorParams, error) {
+	params := make(DetectorParams)
+	schema := make(map[string]bool)
+
+	for _, p := range d.Params() {
+		schema[p.Name] = true
+		val, ok := given[p.Name]
+
+		if !ok {
+			val = p.Default
+		}
+		if val < p.Min || val > p.Max {
+			return nil, fmt.Errorf(
+				"Param %s of method %s out of range [%g, %g]: %g",
+				p.Name, d.Name(), p.Min, p.Max, val,
+			)
+		}
+		params[p.Name] = val
+	}
+	for name := range given {
+		if !schema[name] {
+			return nil, fmt.Errorf("Unknown param %s of method %s", name, d.Name())
+		}
+	}
+	if c, ok := d.(ParamsChecker); ok {
+		if err := c.CheckParams(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+// CheckParamsOrder check detector param low does not exceed param high
+func CheckParamsOrder(d Detector, params DetectorParams, low, high string) error {
+	if params[low] > params[high] {
+		return fmt.Errorf(
+			"Param %s of method %s must not exceed %s: %g > %g",
+			low, d.Name(), high, params[low], params[high],
+		)
+	}
+	return nil
+}
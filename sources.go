@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DataSource DataSet metrics values source
+type DataSource interface {
+	// Fetch get DataSet metrics values of start, end dates window, start includes detectors history before
+	// TimeAgo window
+	Fetch(ds DataSet, start, end time.Time) ([]MetricValues, error)
+}
+
+// DataSourceFactory make DataSource of source config, check config params
+type DataSourceFactory func(config SourceConfig) (DataSource, error)
+
+var dataSources = make(map[string]DataSourceFactory)
+
+// RegisterDataSource add data source type to registry, panics on duplicate types
+func RegisterDataSource(sourceType string, factory DataSourceFactory) {
+	if _, ok := dataSources[sourceType]; ok {
+		panic(fmt.Sprintf("Data source already registered: %s", sourceType))
+	}
+	dataSources[sourceType] = factory
+}
+
+// NewDataSource make registered DataSource by source config type, push by default
+func NewDataSource(config SourceConfig) (DataSource, error) {
+	if config.Type == "" {
+		config.Type = SourcePush
+	}
+	factory, ok := dataSources[config.Type]
+
+	if !ok {
+		return nil, fmt.Errorf("Unsupported source type: %s, expected: %s", config.Type, strings.Join(DataSourcesTypes(), ", "))
+	}
+	return factory(config)
+}
+
+// DataSourcesTypes get sorted types of registered data sources
+func DataSourcesTypes() []string {
+	types := make([]string, 0, len(dataSources))
+
+	for sourceType := range dataSources {
+		types = append(types, sourceType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// UnmarshalJSON decode source config object or type string, like "synthetic"
+func (sc *SourceConfig) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &sc.Type)
+	}
+	type config SourceConfig
+	return json.Unmarshal(data, (*config)(sc))
+}
+
+// GetStep get source config step duration, TimeStep/24 by default
+func (sc SourceConfig) GetStep(timeStep time.Duration) (time.Duration, error) {
+	if sc.Step == "" {
+		return timeStep / 24, nil
+	}
+	return ParseDuration(sc.Step)
+}
+
+// GetQuery get source config query of metric, metric name by default
+func (sc SourceConfig) GetQuery(metric string) string {
+	if query, ok := sc.Queries[metric]; ok {
+		return query
+	}
+	return metric
+}
+
+// PushSource values pushed to ingestion API and stored in values store
+type PushSource struct{}
+
+// Fetch load DataSet stored values since start date
+func (PushSource) Fetch(ds DataSet, start, end time.Time) ([]MetricValues, error) {
+	return LoadIngestedValues(ds.SiteID, start)
+}
+
+// SyntheticSource random values generator
+type SyntheticSource struct{}
+
+// Fetch generate DataSet metrics values
+func (SyntheticSource) Fetch(ds DataSet, start, end time.Time) ([]MetricValues, error) {
+	ds.Metrics = nil
+	ds.GenerateData()
+	return ds.Metrics, nil
+}
+
+// HTTPSource base of HTTP API data sources
+type HTTPSource struct {
+	Config SourceConfig
+	Client *http.Client
+}
+
+// NewHTTPSource make HTTPSource of config, url is required
+func NewHTTPSource(config SourceConfig) (HTTPSource, error) {
+	if _, err := url.ParseRequestURI(config.URL); err != nil || config.URL == "" {
+		return HTTPSource{}, fmt.Errorf("Invalid %s source url: %q", config.Type, config.URL)
+	}
+	return HTTPSource{Config: config, Client: &http.Client{Timeout: SourceHTTPTimeout}}, nil
+}
+
+// Get send GET request to source url path with query params added to url query and config headers,
+// return response body
+func (s HTTPSource) Get(path string, params url.Values) ([]byte, error) {
+	u, err := url.Parse(s.Config.URL)
+
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s source url: %s", s.Config.Type, err)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + path
+	query := u.Query()
+
+	for name, values := range params {
+		query[name] = values
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error create %s source request: %s", s.Config.Type, err)
+	}
+	for name, value := range s.Config.Headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := s.Client.Do(req)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error request %s source: %s", s.Config.Type, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error read %s source response: %s", s.Config.Type, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Error %s source response status %d: %s", s.Config.Type, resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+// PrometheusSource Prometheus-compatible range query HTTP API source, every metric is queried by its
+// config query (metric name by default), series label AttributeLabel value is metric attribute
+type PrometheusSource struct {
+	HTTPSource
+}
+
+// prometheusResponse Prometheus range query response
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		Result []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][2]interface{}  `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// Fetch query every DataSet metric by /api/v1/query_range, NaN and infinite samples are skipped, series without
+// AttributeLabel label is metric total, sums of attributes series are total when query returns no total series
+func (s PrometheusSource) Fetch(ds DataSet, start, end time.Time) (metrics []MetricValues, err error) {
+	_, timeStep, err := ds.GetTimeAgoAndTimeStepDurations()
+
+	if err != nil {
+		return nil, err
+	}
+	step, err := s.Config.GetStep(timeStep)
+
+	if err != nil || step <= 0 {
+		return nil, fmt.Errorf("Invalid prometheus source step: %s", s.Config.Step)
+	}
+	index := make(map[string]int)
+
+	for _, metric := range ds.MetricesList {
+		body, err := s.Get("/api/v1/query_range", url.Values{
+			"query": {s.Config.GetQuery(metric)},
+			"start": {strconv.FormatInt(start.Unix(), 10)},
+			"end":   {strconv.FormatInt(end.Unix(), 10)},
+			"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+		})
+
+		if err != nil {
+			return nil, err
+		}
+		var resp prometheusResponse
+
+		if err = json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("Error decode prometheus response: %s", err)
+		}
+		if resp.Status != "success" {
+			return nil, fmt.Errorf("Error prometheus query of %s: %s", metric, resp.Error)
+		}
+		totals := 0
+
+		for _, series := range resp.Data.Result {
+			if _, ok := series.Metric[s.Config.AttributeLabel]; !ok || s.Config.AttributeLabel == "" {
+				totals++
+			}
+		}
+		if totals > 1 {
+			return nil, fmt.Errorf("Prometheus query of %s returned %d series without attributeLabel, expected single total series", metric, totals)
+		}
+		for _, series := range resp.Data.Result {
+			attribute := ""
+
+			if value, ok := series.Metric[s.Config.AttributeLabel]; ok && s.Config.AttributeLabel != "" {
+				attribute = AttributeLabel(s.Config.AttributeLabel, value)
+			}
+			for _, point := range series.Values {
+				date, value, err := parsePrometheusPoint(point)
+
+				if err != nil {
+					return nil, err
+				}
+				if math.IsNaN(value) || math.IsInf(value, 0) {
+					continue
+				}
+				metrics = AddMetricValue(metrics, index, metric, attribute, DataSetValue{date, value})
+			}
+		}
+		metrics = AddTotalMetricValues(metrics, index, metric)
+	}
+	SortMetricsValues(metrics)
+	return metrics, nil
+}
+
+func parsePrometheusPoint(point [2]interface{}) (date time.Time, value float64, err error) {
+	ts, ok := point[0].(float64)
+	str, ok2 := point[1].(string)
+
+	if !ok || !ok2 {
+		return date, value, errors.New("Invalid prometheus sample, expected [unix time, \"value\"]")
+	}
+	if value, err = strconv.ParseFloat(str, 64); err != nil {
+		return date, value, fmt.Errorf("Invalid prometheus sample value: %s", str)
+	}
+	sec := int64(ts)
+	return time.Unix(sec, int64((ts-float64(sec))*1e9)).UTC(), value, nil
+}
+
+// JSONHTTPSource generic JSON-over-HTTP source, url is requested with siteId, start and end (DateTimeFormat)
+// query params and returns JSON array or NDJSON of ingestion API values
+type JSONHTTPSource struct {
+	HTTPSource
+}
+
+// Fetch request DataSet values of window, values of metrics not in MetricesList are skipped
+func (s JSONHTTPSource) Fetch(ds DataSet, start, end time.Time) (metrics []MetricValues, err error) {
+	body, err := s.Get("", url.Values{
+		"siteId": {ds.SiteID},
+		"start":  {start.UTC().Format(DateTimeFormat)},
+		"end":    {end.UTC().Format(DateTimeFormat)},
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	values, err := DecodeIngestedValues(body)
+
+	if err != nil {
+		return nil, err
+	}
+	index := make(map[string]int)
+
+	for _, v := range values {
+		if !ContainsString(ds.MetricesList, v.Metric) {
+			continue
+		}
+		date, err := ParseValueDate(v.Date)
+
+		if err != nil {
+			return nil, err
+		}
+		metrics = AddMetricValue(metrics, index, v.Metric, v.Attribute, DataSetValue{date, v.Value})
+	}
+	SortMetricsValues(metrics)
+	return metrics, nil
+}
+
+// SQLSource database/sql source, every metric is queried by its parameterized config query with window start
+// and end args, query returns time, value and optional attribute columns rows, attribute column name is its dimension
+type SQLSource struct {
+	Config SourceConfig
+}
+
+var (
+	sqlDBs   = make(map[string]*sql.DB)
+	sqlDBsMu sync.Mutex
+)
+
+// NewSQLSource make SQLSource of config, driver must be registered (imported) and dsn is required
+func NewSQLSource(config SourceConfig) (SQLSource, error) {
+	if !ContainsString(sql.Drivers(), config.Driver) {
+		return SQLSource{}, fmt.Errorf(
+			"SQL driver %q is not registered, expected: %s (sqlite3 is built with -tags sqlite)",
+			config.Driver, strings.Join(sql.Drivers(), ", "),
+		)
+	}
+	if config.DSN == "" {
+		return SQLSource{}, errors.New("Empty sql source dsn")
+	}
+	return SQLSource{Config: config}, nil
+}
+
+// DB get source database connections pool, pools are shared by driver and dsn
+func (s SQLSource) DB() (*sql.DB, error) {
+	sqlDBsMu.Lock()
+	defer sqlDBsMu.Unlock()
+
+	key := s.Config.Driver + "\x00" + s.Config.DSN
+
+	if db, ok := sqlDBs[key]; ok {
+		return db, nil
+	}
+	db, err := sql.Open(s.Config.Driver, s.Config.DSN)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error open sql source: %s", err)
+	}
+	sqlDBs[key] = db
+	return db, nil
+}
+
+// Fetch query every DataSet metric, rows with NULL value are skipped, rows with NULL attribute are metric total,
+// total is sum of attributes values when query returns no total rows
+func (s SQLSource) Fetch(ds DataSet, start, end time.Time) (metrics []MetricValues, err error) {
+	db, err := s.DB()
+
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), SourceSQLTimeout)
+	defer cancel()
+	index := make(map[string]int)
+
+	for _, metric := range ds.MetricesList {
+		query, ok := s.Config.Queries[metric]
+
+		if !ok {
+			return nil, fmt.Errorf("Empty sql source query of metric %s", metric)
+		}
+		if metrics, err = s.queryMetric(ctx, db, metrics, index, metric, query, start, end); err != nil {
+			return nil, err
+		}
+		metrics = AddTotalMetricValues(metrics, index, metric)
+	}
+	SortMetricsValues(metrics)
+	return metrics, nil
+}
+
+func (s SQLSource) queryMetric(ctx context.Context, db *sql.DB, metrics []MetricValues, index map[string]int, metric, query string, start, end time.Time) ([]MetricValues, error) {
+	rows, err := db.QueryContext(ctx, query, s.timeArg(start), s.timeArg(end))
+
+	if err != nil {
+		return nil, fmt.Errorf("Error sql query of metric %s: %s", metric, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+
+	if err != nil || len(columns) < 2 || len(columns) > 3 {
+		return nil, fmt.Errorf("Expected time, value[, attribute] columns of metric %s query", metric)
+	}
+	for rows.Next() {
+		var date interface{}
+		var value sql.NullFloat64
+		var attribute sql.NullString
+		dest := []interface{}{&date, &value, &attribute}
+
+		if err = rows.Scan(dest[:len(columns)]...); err != nil {
+			return nil, fmt.Errorf("Error scan sql row of metric %s: %s", metric, err)
+		}
+		if !value.Valid {
+			continue
+		}
+		t, err := s.parseTime(date)
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid sql time of metric %s: %s", metric, err)
+		}
+		label := ""
+
+		if attribute.Valid {
+			label = AttributeLabel(columns[2], attribute.String)
+		}
+		metrics = AddMetricValue(metrics, index, metric, label, DataSetValue{t, value.Float64})
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error read sql rows of metric %s: %s", metric, err)
+	}
+	return metrics, nil
+}
+
+// timeArg get query window arg by config time format, time value by default
+func (s SQLSource) timeArg(t time.Time) interface{} {
+	switch s.Config.TimeFormat {
+	case "":
+		return t.UTC()
+	case TimeFormatUnix:
+		return t.Unix()
+	}
+	return t.UTC().Format(s.Config.TimeFormat)
+}
+
+// parseTime parse time column value of time, Unix seconds or string in config or ingestion API time format
+func (s SQLSource) parseTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t.UTC(), nil
+	case int64:
+		return time.Unix(t, 0).UTC(), nil
+	case float64:
+		return time.Unix(int64(t), 0).UTC(), nil
+	case []byte:
+		return s.parseTime(string(t))
+	case string:
+		if s.Config.TimeFormat == TimeFormatUnix {
+			sec, err := strconv.ParseInt(t, 10, 64)
+			return time.Unix(sec, 0).UTC(), err
+		}
+		if s.Config.TimeFormat != "" {
+			if date, err := time.Parse(s.Config.TimeFormat, t); err == nil {
+				return date.UTC(), nil
+			}
+		}
+		return ParseValueDate(t)
+	}
+	return time.Time{}, fmt.Errorf("Unexpected time column type %T", v)
+}
+
+func init() {
+	RegisterDataSource(SourcePush, func(SourceConfig) (DataSource, error) {
+		return PushSource{}, nil
+	})
+	RegisterDataSource(SourceSynthetic, func(SourceConfig) (DataSource, error) {
+		return SyntheticSource{}, nil
+	})
+	RegisterDataSource(SourcePrometheus, func(config SourceConfig) (DataSource, error) {
+		s, err := NewHTTPSource(config)
+		return PrometheusSource{s}, err
+	})
+	RegisterDataSource(SourceHTTP, func(config SourceConfig) (DataSource, error) {
+		s, err := NewHTTPSource(config)
+		return JSONHTTPSource{s}, err
+	})
+	RegisterDataSource(SourceSQL, func(config SourceConfig) (DataSource, error) {
+		return NewSQLSource(config)
+	})
+}
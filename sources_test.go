@@ -0,0 +1,273 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSourceServer start HTTP server responding with status and body, requests are passed to check
+func testSourceServer(t *testing.T, status int, body string, check func(r *http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testSQLResults canned test sql driver rows by query, first row is columns names
+var testSQLResults = make(map[string][][]driver.Value)
+
+// testSQLDriver database/sql driver responding to queries with canned testSQLResults rows
+type testSQLDriver struct{}
+
+type testSQLConn struct{}
+
+type testSQLStmt struct {
+	query string
+}
+
+type testSQLRows struct {
+	rows [][]driver.Value
+}
+
+func (testSQLDriver) Open(string) (driver.Conn, error) { return testSQLConn{}, nil }
+
+func (testSQLConn) Prepare(query string) (driver.Stmt, error) { return testSQLStmt{query}, nil }
+func (testSQLConn) Close() error                              { return nil }
+func (testSQLConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+func (testSQLStmt) Close() error                               { return nil }
+func (testSQLStmt) NumInput() int                              { return -1 }
+func (testSQLStmt) Exec([]driver.Value) (driver.Result, error) { return nil, driver.ErrSkip }
+
+func (s testSQLStmt) Query([]driver.Value) (driver.Rows, error) {
+	result, ok := testSQLResults[s.query]
+
+	if !ok {
+		return nil, errors.New("unknown test query")
+	}
+	return &testSQLRows{result}, nil
+}
+
+func (r *testSQLRows) Columns() (columns []string) {
+	for _, column := range r.rows[0] {
+		columns = append(columns, column.(string))
+	}
+	return
+}
+
+func (r *testSQLRows) Close() error { return nil }
+
+func (r *testSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) < 2 {
+		return io.EOF
+	}
+	r.rows = r.rows[1:]
+	copy(dest, r.rows[0])
+	return nil
+}
+
+func init() {
+	sql.Register("testsql", testSQLDriver{})
+}
+
+func TestSQLSourceAttributesTotal(t *testing.T) {
+	hour := func(h int) time.Time { return testStartDate.Add(time.Duration(h) * time.Hour) }
+	testSQLResults["revenue"] = [][]driver.Value{
+		{"ts", "value", "country"},
+		{hour(0).Format(DateTimeFormat), 10.0, "DE"},
+		{hour(0).Format(DateTimeFormat), 5.0, "US"},
+		{hour(1).Format(DateTimeFormat), 30.0, "DE"},
+		{hour(1).Format(DateTimeFormat), nil, "US"},
+	}
+	testSQLResults["orders"] = [][]driver.Value{
+		{"ts", "value", "country"},
+		{hour(0).Unix(), 3.0, nil},
+		{hour(0).Unix(), 2.0, "DE"},
+	}
+	source, err := NewDataSource(SourceConfig{
+		Type:       SourceSQL,
+		Driver:     "testsql",
+		DSN:        "test",
+		TimeFormat: DateTimeFormat,
+		Queries:    map[string]string{"Revenue": "revenue", "Orders": "orders"},
+	})
+
+	if err != nil {
+		t.Fatalf("Error make source: %s", err)
+	}
+	ds := testDataSet("1d", "1h")
+	ds.MetricesList = []string{"Revenue", "Orders"}
+	metrics, err := source.Fetch(ds, hour(0), hour(24))
+
+	if err != nil {
+		t.Fatalf("Error fetch: %s", err)
+	}
+	expected := []MetricValues{
+		{Metric: "Revenue", Attribute: "country=DE", Values: DataSetValues{{hour(0), 10}, {hour(1), 30}}},
+		{Metric: "Revenue", Attribute: "country=US", Values: DataSetValues{{hour(0), 5}}},
+		{Metric: "Revenue", Values: DataSetValues{{hour(0), 15}, {hour(1), 30}}},
+		{Metric: "Orders", Values: DataSetValues{{hour(0), 3}}},
+		{Metric: "Orders", Attribute: "country=DE", Values: DataSetValues{{hour(0), 2}}},
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("Expected attributes by column dimension and summed total %v, got %v", expected, metrics)
+	}
+}
+
+func TestNewSQLSourceErrors(t *testing.T) {
+	if _, err := NewDataSource(SourceConfig{Type: SourceSQL, Driver: "missing", DSN: "test"}); err == nil ||
+		!strings.Contains(err.Error(), "-tags sqlite") {
+		t.Errorf("Expected unregistered driver error with build tag hint, got %v", err)
+	}
+	if _, err := NewDataSource(SourceConfig{Type: SourceSQL, Driver: "testsql"}); err == nil {
+		t.Error("Expected empty dsn error")
+	}
+}
+
+func TestPrometheusSourceFetch(t *testing.T) {
+	body := `{"status": "success", "data": {"resultType": "matrix", "result": [
+		{"metric": {"country": "DE"}, "values": [[1609722000, "2"], [1609718400, "1"], [1609725600, "NaN"]]},
+		{"metric": {"country": "US"}, "values": [[1609718400, "3.5"], [1609722000, "+Inf"], [1609725600, "-Inf"]]}
+	]}}`
+	server := testSourceServer(t, 200, body, func(r *http.Request) {
+		query := r.URL.Query()
+
+		if r.URL.Path != "/prometheus/api/v1/query_range" || query.Get("query") != "sum(orders) by (country)" ||
+			query.Get("step") != "3600" || query.Get("start") == "" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("Unexpected prometheus request: %s %v", r.URL, r.Header)
+		}
+	})
+	source, err := NewDataSource(SourceConfig{
+		Type:           SourcePrometheus,
+		URL:            server.URL + "/prometheus/",
+		Headers:        map[string]string{"Authorization": "Bearer token"},
+		Queries:        map[string]string{"Orders": "sum(orders) by (country)"},
+		Step:           "1h",
+		AttributeLabel: "country",
+	})
+
+	if err != nil {
+		t.Fatalf("Error make source: %s", err)
+	}
+	ds := testDataSet("1d", "1h")
+	ds.MetricesList = []string{"Orders"}
+	metrics, err := source.Fetch(ds, testStartDate, testStartDate.Add(24*time.Hour))
+
+	if err != nil {
+		t.Fatalf("Error fetch: %s", err)
+	}
+	expected := []MetricValues{
+		{Metric: "Orders", Attribute: "country=DE", Values: DataSetValues{{testStartDate, 1}, {testStartDate.Add(time.Hour), 2}}},
+		{Metric: "Orders", Attribute: "country=US", Values: DataSetValues{{testStartDate, 3.5}}},
+		{Metric: "Orders", Values: DataSetValues{{testStartDate, 4.5}, {testStartDate.Add(time.Hour), 2}}},
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("Expected %v, got %v", expected, metrics)
+	}
+}
+
+func TestPrometheusSourceFetchErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"response status", 503, `{"status": "error", "error": "unavailable"}`},
+		{"query status", 200, `{"status": "error", "errorType": "bad_data", "error": "parse error"}`},
+		{"invalid json", 200, `{"status": "success", "data": {`},
+		{"invalid sample", 200, `{"status": "success", "data": {"result": [{"metric": {}, "values": [[1609718400, 1]]}]}}`},
+		{"invalid value", 200, `{"status": "success", "data": {"result": [{"metric": {}, "values": [[1609718400, "one"]]}]}}`},
+		{"several series without attributeLabel", 200, `{"status": "success", "data": {"result": [{"metric": {"country": "DE"}, "values": []},
+			{"metric": {"country": "US"}, "values": []}]}}`},
+	}
+	ds := testDataSet("1d", "1h")
+	ds.MetricesList = []string{"Orders"}
+
+	for _, tt := range tests {
+		source, err := NewDataSource(SourceConfig{Type: SourcePrometheus, URL: testSourceServer(t, tt.status, tt.body, nil).URL})
+
+		if err != nil {
+			t.Fatalf("Error make source: %s", err)
+		}
+		if _, err = source.Fetch(ds, testStartDate, testStartDate.Add(24*time.Hour)); err == nil {
+			t.Errorf("%s: expected fetch error", tt.name)
+		}
+	}
+}
+
+func TestJSONHTTPSourceFetch(t *testing.T) {
+	body := "{\"metric\": \"Revenue\", \"date\": \"2021-01-04 01:00:00\", \"value\": 20}\n" +
+		"{\"metric\": \"Visitors\", \"date\": \"2021-01-04 00:00:00\", \"value\": 5}\n" +
+		"{\"metric\": \"Revenue\", \"date\": \"2021-01-04T00:00:00Z\", \"value\": 10}\n" +
+		"{\"metric\": \"Revenue\", \"attribute\": \"country=DE\", \"date\": \"2021-01-04 00:00:00\", \"value\": 4}\n"
+	server := testSourceServer(t, 200, body, func(r *http.Request) {
+		query := r.URL.Query()
+
+		if query.Get("siteId") != "test" || query.Get("start") != "2021-01-04 00:00:00" || query.Get("end") != "2021-01-05 00:00:00" {
+			t.Errorf("Unexpected http source request: %s", r.URL)
+		}
+	})
+	source, err := NewDataSource(SourceConfig{Type: SourceHTTP, URL: server.URL + "/values"})
+
+	if err != nil {
+		t.Fatalf("Error make source: %s", err)
+	}
+	ds := testDataSet("1d", "1h")
+	ds.MetricesList = []string{"Revenue"}
+	metrics, err := source.Fetch(ds, testStartDate, testStartDate.Add(24*time.Hour))
+
+	if err != nil {
+		t.Fatalf("Error fetch: %s", err)
+	}
+	expected := []MetricValues{
+		{Metric: "Revenue", Values: DataSetValues{{testStartDate, 10}, {testStartDate.Add(time.Hour), 20}}},
+		{Metric: "Revenue", Attribute: "country=DE", Values: DataSetValues{{testStartDate, 4}}},
+	}
+	if !reflect.DeepEqual(metrics, expected) {
+		t.Errorf("Expected %v, got %v", expected, metrics)
+	}
+	for _, tt := range []struct {
+		status int
+		body   string
+	}{{404, "not found"}, {200, `[{"metric": "Revenue", "date": "04.01.2021", "value": 1}]`}, {200, `[{`}} {
+		source, _ := NewDataSource(SourceConfig{Type: SourceHTTP, URL: testSourceServer(t, tt.status, tt.body, nil).URL})
+
+		if _, err = source.Fetch(ds, testStartDate, testStartDate.Add(24*time.Hour)); err == nil {
+			t.Errorf("Expected fetch error of status %d response %s", tt.status, tt.body)
+		}
+	}
+}
+
+func TestLoadDataFetchesHistory(t *testing.T) {
+	var start, end int64
+	server := testSourceServer(t, 200, `{"status": "success", "data": {"result": []}}`, func(r *http.Request) {
+		start, _ = strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		end, _ = strconv.ParseInt(r.URL.Query().Get("end"), 10, 64)
+	})
+	ds := testDataSet("1d", "1h")
+	ds.MetricesList = []string{"Revenue"}
+	ds.OutliersDetectionMethod = []string{PeriodOverPeriod}
+	ds.Source = SourceConfig{Type: SourcePrometheus, URL: server.URL}
+
+	if err := ds.LoadData(); err != nil {
+		t.Fatalf("Error load data: %s", err)
+	}
+	if history := time.Duration(end-start) * time.Second; history != 25*time.Hour+168*time.Hour {
+		t.Errorf("Expected fetched TimeAgo window, TimeStep and week history, got %s", history)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+// sqlite3 database/sql driver of SQL data source, built with -tags sqlite (requires cgo)
+import _ "github.com/mattn/go-sqlite3"
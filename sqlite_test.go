@@ -0,0 +1,118 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testSQLiteSource make sql source of in-memory sqlite database with table created and rows inserted
+func testSQLiteSource(t *testing.T, name, timeFormat, schema string, queries map[string]string, rows [][]interface{}) DataSource {
+	t.Helper()
+	source, err := NewDataSource(SourceConfig{
+		Type:       SourceSQL,
+		Driver:     "sqlite3",
+		DSN:        "file:" + name + "?mode=memory&cache=shared",
+		TimeFormat: timeFormat,
+		Queries:    queries,
+	})
+
+	if err != nil {
+		t.Fatalf("Error make source: %s", err)
+	}
+	db, err := source.(SQLSource).DB()
+
+	if err != nil {
+		t.Fatalf("Error open database: %s", err)
+	}
+	if _, err = db.Exec("CREATE TABLE metrics (" + schema + ")"); err != nil {
+		t.Fatalf("Error create table: %s", err)
+	}
+	for _, row := range rows {
+		if _, err = db.Exec("INSERT INTO metrics VALUES (?, ?, ?, ?)", row...); err != nil {
+			t.Fatalf("Error insert row %v: %s", row, err)
+		}
+	}
+	return source
+}
+
+func TestSQLSourceFetch(t *testing.T) {
+	hour := func(h int) time.Time { return testStartDate.Add(time.Duration(h) * time.Hour) }
+	text := func(h int) interface{} { return hour(h).Format(DateTimeFormat) }
+	unix := func(h int) interface{} { return hour(h).Unix() }
+	date := func(h int) interface{} { return hour(h) }
+	queries := map[string]string{
+		"Revenue": "SELECT ts, value, country FROM metrics WHERE metric = 'Revenue' AND ts >= ? AND ts < ?",
+		"Orders":  "SELECT ts, value FROM metrics WHERE metric = 'Orders' AND ts >= ? AND ts < ? ORDER BY ts DESC",
+	}
+	tests := []struct {
+		name       string
+		timeFormat string
+		schema     string
+		ts         func(h int) interface{}
+	}{
+		{"text", DateTimeFormat, "ts TEXT, metric TEXT, value REAL, country TEXT", text},
+		{"unix", TimeFormatUnix, "ts INTEGER, metric TEXT, value REAL, country TEXT", unix},
+		{"datetime", "", "ts DATETIME, metric TEXT, value REAL, country TEXT", date},
+	}
+	expected := []MetricValues{
+		{Metric: "Revenue", Attribute: "country=DE", Values: DataSetValues{{hour(0), 10}, {hour(2), 30}}},
+		{Metric: "Revenue", Attribute: "country=US", Values: DataSetValues{{hour(1), 5}}},
+		{Metric: "Revenue", Values: DataSetValues{{hour(0), 10}, {hour(1), 5}, {hour(2), 30}}},
+		{Metric: "Orders", Values: DataSetValues{{hour(0), 1}, {hour(1), 2}}},
+	}
+	ds := testDataSet("1d", "1h")
+	ds.MetricesList = []string{"Revenue", "Orders"}
+
+	for _, tt := range tests {
+		source := testSQLiteSource(t, "sql-source-test-"+tt.name, tt.timeFormat, tt.schema, queries, [][]interface{}{
+			{tt.ts(-1), "Revenue", 100, "DE"},
+			{tt.ts(2), "Revenue", 30, "DE"},
+			{tt.ts(0), "Revenue", 10, "DE"},
+			{tt.ts(1), "Revenue", 5, "US"},
+			{tt.ts(1), "Revenue", nil, "DE"},
+			{tt.ts(24), "Revenue", 100, "US"},
+			{tt.ts(1), "Orders", 2, nil},
+			{tt.ts(0), "Orders", 1, nil},
+		})
+		metrics, err := source.Fetch(ds, hour(0), hour(24))
+
+		if err != nil {
+			t.Fatalf("%s: error fetch: %s", tt.name, err)
+		}
+		if !reflect.DeepEqual(metrics, expected) {
+			t.Errorf("%s: expected %v, got %v", tt.name, expected, metrics)
+		}
+	}
+}
+
+func TestSQLSourceFetchErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"columns", "SELECT ts FROM metrics WHERE ts >= ? AND ts < ?"},
+		{"syntax", "SELECT ts, value FROM WHERE ts >= ? AND ts < ?"},
+		{"time", "SELECT metric, value FROM metrics WHERE ts >= ? AND ts < ?"},
+	}
+	ds := testDataSet("1d", "1h")
+	ds.MetricesList = []string{"Revenue"}
+
+	for _, tt := range tests {
+		source := testSQLiteSource(t, "sql-source-errors-test-"+tt.name, DateTimeFormat, "ts TEXT, metric TEXT, value REAL, country TEXT",
+			map[string]string{"Revenue": tt.query}, [][]interface{}{{"2021-01-04 00:00:00", "Revenue", 1, nil}})
+
+		if _, err := source.Fetch(ds, testStartDate, testStartDate.Add(24*time.Hour)); err == nil {
+			t.Errorf("%s: expected fetch error", tt.name)
+		}
+	}
+	ds.MetricesList = []string{"Orders"}
+	source := testSQLiteSource(t, "sql-source-errors-test-query", DateTimeFormat, "ts TEXT, metric TEXT, value REAL, country TEXT", nil, nil)
+
+	if _, err := source.Fetch(ds, testStartDate, testStartDate.Add(24*time.Hour)); err == nil {
+		t.Error("Expected fetch error of metric without query")
+	}
+}
@@ -10,7 +10,11 @@ import (
 	"math/rand"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
 	"time"
+
+	"gonum.org/v1/gonum/stat/distuv"
 )
 
 // WriteResponse write http response
@@ -69,6 +73,36 @@ func StartServer(port uint) {
 	log.Fatalln(server.ListenAndServe())
 }
 
+// Mean calc mean value
+func Mean(args ...float64) float64 {
+	if len(args) == 0 {
+		return 0
+	}
+
+	var sum float64
+
+	for i := range args {
+		sum += args[i]
+	}
+	return sum / float64(len(args))
+}
+
+// DirectionSign get direction sign, 1 for up and -1 for down
+func DirectionSign(direction string) float64 {
+	if direction == DirectionDown {
+		return -1
+	}
+	return 1
+}
+
+// SeasonalSlot get hour-of-day slot of date, or weekday and hour-of-day slot
+func SeasonalSlot(dt time.Time, weekday bool) int {
+	if weekday {
+		return int(dt.Weekday())*24 + dt.Hour()
+	}
+	return dt.Hour()
+}
+
 // MeanStDev calc mean and standart deviation
 func MeanStDev(args ...float64) (mean float64, stdDev float64) {
 	l := float64(len(args))
@@ -91,6 +125,204 @@ func MeanStDev(args ...float64) (mean float64, stdDev float64) {
 	return mean, stdDev
 }
 
+// Median calc median value
+func Median(args ...float64) float64 {
+	l := len(args)
+
+	if l == 0 {
+		return 0
+	}
+	vals := make([]float64, l)
+	copy(vals, args)
+	sort.Float64s(vals)
+
+	if l%2 == 0 {
+		return (vals[l/2-1] + vals[l/2]) / 2
+	}
+	return vals[l/2]
+}
+
+// Quantile calc p-quantile (0 <= p <= 1) with linear interpolation between closest ranks
+func Quantile(p float64, args ...float64) float64 {
+	l := len(args)
+
+	if l == 0 {
+		return 0
+	}
+	vals := make([]float64, l)
+	copy(vals, args)
+	sort.Float64s(vals)
+
+	pos := p * float64(l-1)
+	lower := int(math.Floor(pos))
+
+	if lower >= l-1 {
+		return vals[l-1]
+	}
+	return vals[lower] + (pos-float64(lower))*(vals[lower+1]-vals[lower])
+}
+
+// MedianMAD calc median and median absolute deviation
+func MedianMAD(args ...float64) (median float64, mad float64) {
+	if len(args) == 0 {
+		return
+	}
+	median = Median(args...)
+	deviations := make([]float64, len(args))
+
+	for i := range args {
+		deviations[i] = math.Abs(args[i] - median)
+	}
+	return median, Median(deviations...)
+}
+
+// HoltWintersForecast calc one-step-ahead forecast of series by additive triple exponential smoothing,
+// first season is used for initialization, its forecast and forecast of NaN (missing) values is NaN
+func HoltWintersForecast(series []float64, season int, alpha, beta, gamma float64) []float64 {
+	forecast := make([]float64, len(series))
+
+	for i := range forecast {
+		forecast[i] = math.NaN()
+	}
+	if season < 1 || len(series) < 2*season {
+		return forecast
+	}
+	first, second := SkipNaN(series[:season]...), SkipNaN(series[season:2*season]...)
+
+	if len(first) == 0 || len(second) == 0 {
+		return forecast
+	}
+	level := Mean(first...)
+	trend := (Mean(second...) - level) / float64(season)
+	seasonal := make([]float64, season)
+
+	for i := 0; i < season; i++ {
+		if !math.IsNaN(series[i]) {
+			seasonal[i] = series[i] - level
+		}
+	}
+
+	for i := season; i < len(series); i++ {
+		s := seasonal[i%season]
+		predicted := level + trend + s
+
+		if math.IsNaN(series[i]) {
+			level += trend
+			continue
+		}
+		forecast[i] = predicted
+		prevLevel := level
+		level = alpha*(series[i]-s) + (1-alpha)*(level+trend)
+		trend = beta*(level-prevLevel) + (1-beta)*trend
+		seasonal[i%season] = gamma*(series[i]-level) + (1-gamma)*s
+	}
+	return forecast
+}
+
+// SkipNaN return values without NaN
+func SkipNaN(args ...float64) []float64 {
+	vals := make([]float64, 0, len(args))
+
+	for i := range args {
+		if !math.IsNaN(args[i]) {
+			vals = append(vals, args[i])
+		}
+	}
+	return vals
+}
+
+// GeneralizedESD run Rosner's generalized extreme Studentized deviate test for up to maxOutliers outliers,
+// return outlier candidates in removal order and count of significant outliers for every alpha
+func GeneralizedESD(vals []float64, maxOutliers int, alphas ...float64) (candidates []ESDCandidate, counts []int) {
+	n := len(vals)
+	counts = make([]int, len(alphas))
+	removed := make([]bool, n)
+
+	var sum, sumSq float64
+
+	for _, v := range vals {
+		sum += v
+		sumSq += v * v
+	}
+
+	for i := 1; i <= maxOutliers && n-i > 1; i++ {
+		rest := float64(n - i + 1)
+		mean := sum / rest
+		stDev := math.Sqrt(math.Max(0, (sumSq-rest*mean*mean)/(rest-1)))
+
+		if stDev == 0 {
+			break
+		}
+		candidate, deviation := -1, 0.0
+
+		for j, v := range vals {
+			if d := math.Abs(v - mean); !removed[j] && d >= deviation {
+				candidate, deviation = j, d
+			}
+		}
+		removed[candidate] = true
+		sum -= vals[candidate]
+		sumSq -= vals[candidate] * vals[candidate]
+
+		df := float64(n - i - 1)
+		c := ESDCandidate{Index: candidate, Statistic: deviation / stDev, Critical: make([]float64, len(alphas))}
+
+		for k, alpha := range alphas {
+			t := distuv.StudentsT{Mu: 0, Sigma: 1, Nu: df}.Quantile(1 - alpha/(2*rest))
+			c.Critical[k] = float64(n-i) * t / math.Sqrt((df+t*t)*rest)
+
+			if c.Statistic > c.Critical[k] {
+				counts[k] = i
+			}
+		}
+		candidates = append(candidates, c)
+	}
+	return
+}
+
+// PointsMetrics get unique metrics of outlier points in order of appearance
+func PointsMetrics(points []OutlierPoint) []string {
+	var metrics []string
+
+	for _, p := range points {
+		metrics = append(metrics, p.Metrics...)
+	}
+	return UniqueStrings(metrics...)
+}
+
+// UniqueStrings get unique strings in order of appearance
+func UniqueStrings(args ...string) (unique []string) {
+	seen := make(map[string]bool)
+
+	for _, arg := range args {
+		if !seen[arg] {
+			seen[arg] = true
+			unique = append(unique, arg)
+		}
+	}
+	return
+}
+
+// AttributeLabel make metric attribute of dimension value, like country=DE
+func AttributeLabel(dimension, value string) string {
+	return dimension + "=" + value
+}
+
+// AttributeDimension get dimension of metric attribute
+func AttributeDimension(attribute string) string {
+	return strings.SplitN(attribute, "=", 2)[0]
+}
+
+// ContainsString check string in slice
+func ContainsString(list []string, s string) bool {
+	for i := range list {
+		if list[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
 // GenerateValue generates random values ​​depending on the time
 // and generates outliers on the 11th (warning) and 12th (alarm) from 13:00 to 18:00
 func GenerateValue(dt time.Time) float64 {
@@ -127,3 +359,196 @@ func ParseDates(stringDates ...string) ([]time.Time, error) {
 	}
 	return dates, nil
 }
+
+// Aggregate aggregate values by aggregation function, mean by default
+func Aggregate(aggregation string, args ...float64) float64 {
+	switch aggregation {
+	case AggregationSum:
+		sum := 0.0
+
+		for _, v := range args {
+			sum += v
+		}
+		return sum
+	case AggregationCount:
+		return float64(len(args))
+	case AggregationMin:
+		min := math.Inf(1)
+
+		for _, v := range args {
+			min = math.Min(min, v)
+		}
+		return min
+	case AggregationMax:
+		max := math.Inf(-1)
+
+		for _, v := range args {
+			max = math.Max(max, v)
+		}
+		return max
+	case AggregationP95:
+		return Quantile(0.95, args...)
+	}
+	return Mean(args...)
+}
+
+// FillEmpty fill NaN values by empty handling, zero, previous value or linear interpolation between
+// neighbour values, NaN values are kept on skip and where no neighbour value exists
+func FillEmpty(vals []float64, empty string) {
+	prev := -1
+
+	for i := range vals {
+		if math.IsNaN(vals[i]) {
+			continue
+		}
+		for j := prev + 1; j < i; j++ {
+			switch {
+			case empty == EmptyPrevious && prev >= 0:
+				vals[j] = vals[prev]
+			case empty == EmptyInterpolate && prev >= 0:
+				vals[j] = vals[prev] + (vals[i]-vals[prev])*float64(j-prev)/float64(i-prev)
+			}
+		}
+		prev = i
+	}
+	for i := range vals {
+		switch {
+		case math.IsNaN(vals[i]) && empty == EmptyZero:
+			vals[i] = 0
+		case math.IsNaN(vals[i]) && empty == EmptyPrevious && i > 0:
+			vals[i] = vals[i-1]
+		}
+	}
+}
+
+// ChangePointProbabilities run Bayesian online change-point detection (Adams, MacKay) over standardized series
+// with Normal-Gamma prior and constant hazard 1/hazardRun, return for every index the posterior probability
+// that a new run starts at it, evaluated delay values later, NaN values are skipped and their probability is 0,
+// runs longer than delay are truncated by TruncateRuns to keep cost linear in series length
+func ChangePointProbabilities(series []float64, hazardRun float64, delay int) []float64 {
+	hazard := 1 / hazardRun
+	probs := make([]float64, len(series))
+	runs := []float64{1}
+	mu, kappa, alpha, beta := []float64{0}, []float64{1}, []float64{1}, []float64{1}
+	var seen []int
+
+	for i, x := range series {
+		if math.IsNaN(x) {
+			continue
+		}
+		next := make([]float64, len(runs)+1)
+		var evidence float64
+
+		for r := range runs {
+			scale := math.Sqrt(beta[r] * (kappa[r] + 1) / (alpha[r] * kappa[r]))
+			pred := runs[r] * distuv.StudentsT{Mu: mu[r], Sigma: scale, Nu: 2 * alpha[r]}.Prob(x)
+			next[r+1] = pred * (1 - hazard)
+			next[0] += pred * hazard
+			evidence += pred
+		}
+		if evidence == 0 || math.IsNaN(evidence) {
+			next = make([]float64, len(runs)+1)
+			next[0], evidence = 1, 1
+		}
+		for r := range next {
+			next[r] /= evidence
+		}
+		for r := range runs {
+			beta[r] += kappa[r] * (x - mu[r]) * (x - mu[r]) / (2 * (kappa[r] + 1))
+			mu[r] = (kappa[r]*mu[r] + x) / (kappa[r] + 1)
+			kappa[r]++
+			alpha[r] += 0.5
+		}
+		mu, kappa = append([]float64{0}, mu...), append([]float64{1}, kappa...)
+		alpha, beta = append([]float64{1}, alpha...), append([]float64{1}, beta...)
+		runs = next
+		seen = append(seen, i)
+
+		if len(runs) > delay+2 {
+			runs, mu, kappa, alpha, beta = TruncateRuns(delay+2, runs, mu, kappa, alpha, beta)
+		}
+
+		if t := len(seen) - 1; t > delay {
+			probs[seen[t-delay]] = runs[delay+1]
+		}
+	}
+	return probs
+}
+
+// AddMetricValue append value to metrics values of metric and attribute, index maps metric and attribute
+// to metrics position
+func AddMetricValue(metrics []MetricValues, index map[string]int, metric, attribute string, v DataSetValue) []MetricValues {
+	key := metric + "\x00" + attribute
+	i, ok := index[key]
+
+	if !ok {
+		i = len(metrics)
+		index[key] = i
+		metrics = append(metrics, MetricValues{Metric: metric, Attribute: attribute})
+	}
+	metrics[i].Values = append(metrics[i].Values, v)
+	return metrics
+}
+
+// AddTotalMetricValues add metric total values as sums of its attributes values of same dates, when metric has
+// no total values
+func AddTotalMetricValues(metrics []MetricValues, index map[string]int, metric string) []MetricValues {
+	if _, ok := index[metric+"\x00"]; ok {
+		return metrics
+	}
+	sums := make(map[int64]float64)
+
+	for _, mv := range metrics {
+		if mv.Metric != metric {
+			continue
+		}
+		for _, v := range mv.Values {
+			sums[v.Date.UnixNano()] += v.Value
+		}
+	}
+	dates := make([]int64, 0, len(sums))
+
+	for date := range sums {
+		dates = append(dates, date)
+	}
+	sort.Slice(dates, func(i, j int) bool {
+		return dates[i] < dates[j]
+	})
+
+	for _, date := range dates {
+		metrics = AddMetricValue(metrics, index, metric, "", DataSetValue{time.Unix(0, date).UTC(), sums[date]})
+	}
+	return metrics
+}
+
+// SortMetricsValues sort every metric values by date
+func SortMetricsValues(metrics []MetricValues) {
+	for _, mv := range metrics {
+		values := mv.Values
+
+		sort.SliceStable(values, func(i, j int) bool {
+			return values[i].Date.Before(values[j].Date)
+		})
+	}
+}
+
+// TruncateRuns drop runs after keep first ones with probability below ChangePointMinRunProbability or out of
+// ChangePointMaxRuns most probable ones together with their statistics
+func TruncateRuns(keep int, runs, mu, kappa, alpha, beta []float64) ([]float64, []float64, []float64, []float64, []float64) {
+	threshold := ChangePointMinRunProbability
+
+	if len(runs)-keep > ChangePointMaxRuns {
+		probs := append([]float64(nil), runs[keep:]...)
+		sort.Sort(sort.Reverse(sort.Float64Slice(probs)))
+		threshold = math.Max(threshold, probs[ChangePointMaxRuns-1])
+	}
+	n := keep
+
+	for r := keep; r < len(runs); r++ {
+		if runs[r] >= threshold {
+			runs[n], mu[n], kappa[n], alpha[n], beta[n] = runs[r], mu[r], kappa[r], alpha[r], beta[r]
+			n++
+		}
+	}
+	return runs[:n], mu[:n], kappa[:n], alpha[:n], beta[:n]
+}
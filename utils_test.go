@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestChangePointProbabilities(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	series := make([]float64, 5000)
+
+	for i := range series {
+		series[i] = rnd.NormFloat64()
+
+		if i >= 4000 {
+			series[i] += 4
+		}
+		if i%97 == 0 {
+			series[i] = math.NaN()
+		}
+	}
+	probs := ChangePointProbabilities(series, 250, 6)
+	top := 0
+
+	for i := range probs {
+		if probs[i] > probs[top] {
+			top = i
+		}
+	}
+	if top < 3998 || top > 4002 || probs[top] < 0.5 {
+		t.Errorf("Expected change point at 4000 with probability above 0.5, got %d: %g", top, probs[top])
+	}
+	for i := range probs {
+		if i < 3990 && probs[i] > 0.5 {
+			t.Errorf("Unexpected change point at %d: %g", i, probs[i])
+		}
+	}
+}
+
+func TestTruncateRuns(t *testing.T) {
+	n := ChangePointMaxRuns * 3
+	runs, stat := make([]float64, n), make([]float64, n)
+
+	for i := range runs {
+		runs[i], stat[i] = float64(i)/float64(n*n), float64(i)
+	}
+	runs[10] = 0
+	runs, mu, _, _, _ := TruncateRuns(8, runs, stat, append([]float64(nil), stat...), append([]float64(nil), stat...), append([]float64(nil), stat...))
+
+	if len(runs) != 8+ChangePointMaxRuns {
+		t.Fatalf("Expected %d runs, got %d", 8+ChangePointMaxRuns, len(runs))
+	}
+	for i := 0; i < 8; i++ {
+		if mu[i] != float64(i) {
+			t.Errorf("Expected kept first run %d, got %g", i, mu[i])
+		}
+	}
+	if mu[8] != float64(n-ChangePointMaxRuns) || mu[len(mu)-1] != float64(n-1) {
+		t.Errorf("Expected the most probable runs, got from %g to %g", mu[8], mu[len(mu)-1])
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	vals := []float64{3, 1, 4, 1, 5}
+	tests := []struct {
+		aggregation string
+		value       float64
+	}{
+		{AggregationSum, 14},
+		{AggregationMean, 2.8},
+		{"", 2.8},
+		{AggregationCount, 5},
+		{AggregationMin, 1},
+		{AggregationMax, 5},
+		{AggregationP95, 4.8},
+	}
+	for _, tt := range tests {
+		if val := Aggregate(tt.aggregation, vals...); math.Abs(val-tt.value) > 1e-12 {
+			t.Errorf("%q: expected %g, got %g", tt.aggregation, tt.value, val)
+		}
+	}
+}
+
+func TestFillEmpty(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		empty    string
+		expected []float64
+	}{
+		{EmptySkip, []float64{nan, 1, nan, nan, 4, nan}},
+		{EmptyZero, []float64{0, 1, 0, 0, 4, 0}},
+		{EmptyPrevious, []float64{nan, 1, 1, 1, 4, 4}},
+		{EmptyInterpolate, []float64{nan, 1, 2, 3, 4, nan}},
+	}
+	for _, tt := range tests {
+		vals := []float64{nan, 1, nan, nan, 4, nan}
+		FillEmpty(vals, tt.empty)
+
+		for i := range vals {
+			if vals[i] != tt.expected[i] && !(math.IsNaN(vals[i]) && math.IsNaN(tt.expected[i])) {
+				t.Errorf("%s: expected %v, got %v", tt.empty, tt.expected, vals)
+				break
+			}
+		}
+	}
+}
+
+func TestGeneralizedESDCriticalValues(t *testing.T) {
+	vals := make([]float64, 54)
+
+	for i := range vals {
+		vals[i] = float64(i % 7)
+	}
+	vals[10] = 40
+	candidates, counts := GeneralizedESD(vals, 3, 0.05)
+
+	// Rosner (1983) critical values of 54 values at 0.05 significance
+	for i, expected := range []float64{3.159, 3.151, 3.144} {
+		if math.Abs(candidates[i].Critical[0]-expected) > 1e-3 {
+			t.Errorf("Expected critical value %d %v, got %v", i+1, expected, candidates[i].Critical[0])
+		}
+	}
+	if candidates[0].Index != 10 || counts[0] != 1 {
+		t.Errorf("Expected single outlier at 10, got %+v, counts %v", candidates, counts)
+	}
+}